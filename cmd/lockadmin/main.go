@@ -0,0 +1,173 @@
+// lockadmin 分布式锁管理工具，查看 lock.NewTryLock 加的锁的持有者、剩余过期时间，强制释放卡住的锁
+//
+//	lockadmin -host 127.0.0.1 -port 6379 list [prefix]
+//	lockadmin -host 127.0.0.1 -port 6379 show <key>
+//	lockadmin -host 127.0.0.1 -port 6379 -operator zhangsan -reason "job stuck" release <key>
+//	lockadmin -host 127.0.0.1 -port 6379 audit [n]
+//	lockadmin -host redis.internal -port 6380 -user admin -passwd xxx -db 2 -tls list
+//
+// 密码也可以通过环境变量 REDIS_PASSWD 传入，避免出现在进程列表中
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xiyouhpy/tool/lock"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// timeFormat 输出时间格式
+const timeFormat = "2006-01-02 15:04:05"
+
+// options 命令行参数
+type options struct {
+	host          string
+	port          string
+	user          string
+	passwd        string
+	db            int
+	tls           bool
+	tlsSkipVerify bool
+	format        string
+	operator      string
+	reason        string
+}
+
+func main() {
+	opt := &options{}
+	flag.StringVar(&opt.host, "host", "127.0.0.1", "redis host")
+	flag.StringVar(&opt.port, "port", "6379", "redis port")
+	flag.StringVar(&opt.user, "user", "", "redis ACL username")
+	flag.StringVar(&opt.passwd, "passwd", os.Getenv("REDIS_PASSWD"), "redis password, default $REDIS_PASSWD")
+	flag.IntVar(&opt.db, "db", 0, "redis database")
+	flag.BoolVar(&opt.tls, "tls", false, "connect to redis over TLS")
+	flag.BoolVar(&opt.tlsSkipVerify, "tls-skip-verify", false, "skip redis server certificate verification")
+	flag.StringVar(&opt.format, "format", "text", "output format: text/json")
+	flag.StringVar(&opt.operator, "operator", os.Getenv("USER"), "operator recorded in audit log when release")
+	flag.StringVar(&opt.reason, "reason", "", "reason recorded in audit log when release")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: lockadmin [flags] list [prefix] | show <key> | release <key> | audit [n]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(opt, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// run 执行子命令
+func run(opt *options, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if opt.format != "text" && opt.format != "json" {
+		return errors.New("invalid format:" + opt.format)
+	}
+
+	admin, err := lock.NewAdminFromConf(store.RedisPoolConf{
+		Host:          opt.host,
+		Port:          opt.port,
+		Username:      opt.user,
+		Passwd:        opt.passwd,
+		DB:            opt.db,
+		TLS:           opt.tls,
+		TLSSkipVerify: opt.tlsSkipVerify,
+		MaxIdle:       1,
+	})
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	switch args[0] {
+	case "list":
+		prefix := ""
+		if len(args) > 1 {
+			prefix = args[1]
+		}
+		infos, err := admin.List(prefix)
+		if err != nil {
+			return err
+		}
+		printInfos(opt, infos)
+	case "show":
+		if len(args) < 2 {
+			return errors.New("show need key")
+		}
+		info, err := admin.Get(args[1])
+		if err != nil {
+			return err
+		}
+		printInfos(opt, []lock.LockInfo{*info})
+	case "release":
+		if len(args) < 2 {
+			return errors.New("release need key")
+		}
+		if err := admin.ForceRelease(args[1], opt.operator, opt.reason); err != nil {
+			return err
+		}
+		fmt.Println("released", args[1])
+	case "audit":
+		n := 20
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil {
+				return errors.New("invalid n:" + args[1])
+			}
+		}
+		records, err := admin.Audit(n)
+		if err != nil {
+			return err
+		}
+		printAudit(opt, records)
+	default:
+		return errors.New("unknown command:" + args[0])
+	}
+
+	return nil
+}
+
+// printInfos 输出锁持有信息
+func printInfos(opt *options, infos []lock.LockInfo) {
+	if opt.format == "json" {
+		json.NewEncoder(os.Stdout).Encode(infos)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tHOLDER\tTTL\tHOSTNAME\tPID\tACQUIRED_AT\tPURPOSE")
+	for _, info := range infos {
+		acquiredAt := "-"
+		if !info.AcquiredAt.IsZero() {
+			acquiredAt = info.AcquiredAt.Format(timeFormat)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", info.Key, info.Holder, info.TTL.Round(time.Millisecond),
+			info.Hostname, info.Pid, acquiredAt, info.Purpose)
+	}
+	w.Flush()
+}
+
+// printAudit 输出审计记录
+func printAudit(opt *options, records []lock.AuditRecord) {
+	if opt.format == "json" {
+		json.NewEncoder(os.Stdout).Encode(records)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tKEY\tHOLDER\tHOSTNAME\tPID\tOPERATOR\tREASON")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", r.Time.Format(timeFormat), r.Key, r.Holder,
+			r.Hostname, r.Pid, r.Operator, r.Reason)
+	}
+	w.Flush()
+}
@@ -0,0 +1,235 @@
+// logsearch 日志检索分析工具，读取 log.NewLogger 生成的 access.log.%Y%m%d%H 切割文件（含 .gz 压缩文件），
+// 按时间范围、级别、字段、正则过滤后输出，或者统计各级别条数、高频日志和高频调用位置
+//
+//	logsearch -path ./log/access.log -start "2021-06-01 10:00:00" -end "2021-06-01 12:00:00" -level warn
+//	logsearch -path ./log/access.log -field uid=123 -grep "redis.* err" -format json
+//	logsearch -path ./log/access.log -stats -top 20
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// templateReg 统计高频日志时抹掉日志中的数字部分
+var templateReg = regexp.MustCompile(`[0-9]+`)
+
+// fieldFlags 可重复的 -field key=value 参数
+type fieldFlags map[string]string
+
+// String flag.Value 接口
+func (f fieldFlags) String() string {
+	var arr []string
+	for k, v := range f {
+		arr = append(arr, k+"="+v)
+	}
+
+	return strings.Join(arr, ",")
+}
+
+// Set flag.Value 接口
+func (f fieldFlags) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return errors.New("field should be key=value")
+	}
+	f[kv[0]] = kv[1]
+
+	return nil
+}
+
+// options 命令行参数
+type options struct {
+	path   string
+	start  time.Time
+	end    time.Time
+	level  logrus.Level
+	fields fieldFlags
+	grep   *regexp.Regexp
+	format string
+	stats  bool
+	top    int
+}
+
+// counter 统计计数
+type counter map[string]int
+
+// keyCount 统计结果
+type keyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+func main() {
+	opt, err := parseFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	files, err := rotatedFiles(opt.path, opt.start, opt.end)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	levels, messages, callers := counter{}, counter{}, counter{}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, f := range files {
+		err := scanFile(f.path, func(rec *record) {
+			if !match(opt, rec) {
+				return
+			}
+			if opt.stats {
+				levels[rec.fields["level"]]++
+				messages[templateReg.ReplaceAllString(rec.fields["msg"], "#")]++
+				if caller := rec.caller(); caller != "" {
+					callers[caller]++
+				}
+				return
+			}
+			if opt.format == "json" {
+				encoder.Encode(rec.fields)
+				return
+			}
+			fmt.Println(rec.line)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read file err, file:%s, err:%s\n", f.path, err.Error())
+		}
+	}
+
+	if opt.stats {
+		printStats(opt, levels, messages, callers)
+	}
+}
+
+// parseFlags 解析命令行参数
+func parseFlags() (*options, error) {
+	opt := &options{fields: fieldFlags{}}
+	var start, end, level, grep string
+	flag.StringVar(&opt.path, "path", "./log/access.log", "log file path configured in NewLogger, rotated files are path.%Y%m%d%H[.gz]")
+	flag.StringVar(&start, "start", "", "start time, format: 2006-01-02 15:04:05")
+	flag.StringVar(&end, "end", "", "end time, format: 2006-01-02 15:04:05")
+	flag.StringVar(&level, "level", "", "minimum level, e.g. warn means warning/error/fatal/panic")
+	flag.Var(opt.fields, "field", "field filter key=value, can be repeated")
+	flag.StringVar(&grep, "grep", "", "regexp matched against msg")
+	flag.StringVar(&opt.format, "format", "text", "output format: text/json")
+	flag.BoolVar(&opt.stats, "stats", false, "print count by level, top messages and top callers instead of records")
+	flag.IntVar(&opt.top, "top", 10, "number of top messages/callers in stats")
+	flag.Parse()
+
+	var err error
+	if opt.start, err = parseTime(start); err != nil {
+		return nil, err
+	}
+	if opt.end, err = parseTime(end); err != nil {
+		return nil, err
+	}
+	opt.level = logrus.TraceLevel
+	if level != "" {
+		if opt.level, err = logrus.ParseLevel(level); err != nil {
+			return nil, err
+		}
+	}
+	if grep != "" {
+		if opt.grep, err = regexp.Compile(grep); err != nil {
+			return nil, err
+		}
+	}
+	if opt.format != "text" && opt.format != "json" {
+		return nil, errors.New("invalid format:" + opt.format)
+	}
+
+	return opt, nil
+}
+
+// parseTime 解析时间参数，支持只精确到小时或天
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{timeFormat, "2006-01-02 15:04", "2006-01-02 15", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("invalid time:" + s)
+}
+
+// match 判断日志是否满足过滤条件
+func match(opt *options, rec *record) bool {
+	if !opt.start.IsZero() && rec.time.Before(opt.start) {
+		return false
+	}
+	if !opt.end.IsZero() && rec.time.After(opt.end) {
+		return false
+	}
+	if level, err := logrus.ParseLevel(rec.fields["level"]); err == nil && level > opt.level {
+		return false
+	}
+	for k, v := range opt.fields {
+		if rec.fields[k] != v {
+			return false
+		}
+	}
+	if opt.grep != nil && !opt.grep.MatchString(rec.fields["msg"]) {
+		return false
+	}
+
+	return true
+}
+
+// printStats 输出统计结果
+func printStats(opt *options, levels counter, messages counter, callers counter) {
+	if opt.format == "json" {
+		json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"levels":   levels,
+			"messages": topN(messages, opt.top),
+			"callers":  topN(callers, opt.top),
+		})
+		return
+	}
+
+	fmt.Println("== count by level")
+	for _, kv := range topN(levels, 0) {
+		fmt.Printf("%8d  %s\n", kv.Count, kv.Key)
+	}
+	fmt.Println("== top messages")
+	for _, kv := range topN(messages, opt.top) {
+		fmt.Printf("%8d  %s\n", kv.Count, kv.Key)
+	}
+	fmt.Println("== top callers")
+	for _, kv := range topN(callers, opt.top) {
+		fmt.Printf("%8d  %s\n", kv.Count, kv.Key)
+	}
+}
+
+// topN 按计数从大到小排序，n 为 0 时返回全部
+func topN(c counter, n int) []keyCount {
+	arr := make([]keyCount, 0, len(c))
+	for k, v := range c {
+		arr = append(arr, keyCount{Key: k, Count: v})
+	}
+	sort.Slice(arr, func(i, j int) bool {
+		if arr[i].Count != arr[j].Count {
+			return arr[i].Count > arr[j].Count
+		}
+		return arr[i].Key < arr[j].Key
+	})
+	if n > 0 && len(arr) > n {
+		arr = arr[:n]
+	}
+
+	return arr
+}
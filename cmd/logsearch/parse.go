@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat NewLogger 输出的日志时间格式
+const timeFormat = "2006-01-02 15:04:05"
+
+// suffixFormat NewLogger 切割文件的时间后缀格式，对应 rotatelogs 的 %Y%m%d%H
+const suffixFormat = "2006010215"
+
+// logFile 切割后的单个日志文件
+type logFile struct {
+	path string
+	hour time.Time
+}
+
+// record 单条日志，text 和 json 格式统一解析成字段
+type record struct {
+	line   string
+	fields map[string]string
+	time   time.Time
+}
+
+// rotatedFiles 获取时间范围内的切割文件，支持 gzip 压缩后的 .gz 文件，按时间排序
+func rotatedFiles(base string, start time.Time, end time.Time) ([]logFile, error) {
+	paths, err := filepath.Glob(base + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	// 1、解析文件名中的时间后缀
+	var files []logFile
+	for _, path := range paths {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filepath.Base(base)+"."), ".gz")
+		hour, err := time.ParseInLocation(suffixFormat, suffix, time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: path, hour: hour})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].hour.Before(files[j].hour)
+	})
+
+	// 2、文件覆盖的时间段为 [当前文件时间，下一个文件时间)
+	var ret []logFile
+	for i, f := range files {
+		if !end.IsZero() && f.hour.After(end) {
+			break
+		}
+		if !start.IsZero() && i+1 < len(files) && !files[i+1].hour.After(start) {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no log file found, path:" + base)
+	}
+
+	return ret, nil
+}
+
+// openFile 打开日志文件，.gz 文件自动解压
+func openFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &gzipFile{Reader: reader, file: file}, nil
+}
+
+// gzipFile 关闭时同时关闭解压对象和文件
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close 关闭解压对象和文件
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// scanFile 逐行解析日志文件
+func scanFile(path string, fn func(rec *record)) error {
+	reader, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields, err := parseLine(line)
+		if err != nil {
+			continue
+		}
+		rec := &record{line: line, fields: fields}
+		rec.time, _ = time.ParseInLocation(timeFormat, fields["time"], time.Local)
+		fn(rec)
+	}
+
+	return scanner.Err()
+}
+
+// parseLine 解析单行日志，以 { 开头的按 json 格式解析，否则按 logrus text（key=value）格式解析
+func parseLine(line string) (map[string]string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, errors.New("empty line")
+	}
+	if line[0] == '{' {
+		return parseJSON(line)
+	}
+
+	return parseText(line)
+}
+
+// parseJSON 解析 json 格式日志，非字符串的值转成字符串
+func parseJSON(line string) (map[string]string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			fields[k] = s
+			continue
+		}
+		b, _ := json.Marshal(v)
+		fields[k] = string(b)
+	}
+
+	return fields, nil
+}
+
+// parseText 解析 logrus text 格式日志：key=value key="quoted value"
+func parseText(line string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for i := 0; i < len(line); {
+		// 1、跳过空白，读取 key
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		eq := strings.IndexByte(line[i:], '=')
+		if eq <= 0 {
+			break
+		}
+		key := line[i : i+eq]
+		i += eq + 1
+
+		// 2、读取 value，带引号的需要处理转义
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated quote, key:%s", key)
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+		end := strings.IndexByte(line[i:], ' ')
+		if end < 0 {
+			end = len(line) - i
+		}
+		fields[key] = line[i : i+end]
+		i += end
+	}
+	if _, ok := fields["level"]; !ok {
+		return nil, errors.New("not a log line")
+	}
+
+	return fields, nil
+}
+
+// caller 获取日志的调用位置，兼容 text 格式的 file 字段和 redis hook 的 caller 字段
+func (rec *record) caller() string {
+	if file := rec.fields["file"]; file != "" {
+		return file
+	}
+
+	return rec.fields["caller"]
+}
@@ -0,0 +1,210 @@
+// Package cron 分布式定时任务，按 cron 表达式在多个节点上调度任务，每次触发通过分布式锁保证只在一个节点上执行
+package cron
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchYears 计算下次触发时间时最多向后查找的年数，超过说明表达式不会触发（如 2 月 30 日）
+const maxSearchYears = 5
+
+// fieldRange cron 表达式各字段的取值范围
+type fieldRange struct {
+	min   int
+	max   int
+	names map[string]int
+}
+
+// 各字段取值范围：分、时、日、月、周
+var (
+	minuteRange = fieldRange{min: 0, max: 59}
+	hourRange   = fieldRange{min: 0, max: 23}
+	domRange    = fieldRange{min: 1, max: 31}
+	monthRange  = fieldRange{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowRange = fieldRange{min: 0, max: 6, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors 预定义表达式
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule 解析后的 cron 表达式，各字段用 bit 位表示允许的取值
+type Schedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domStar/dowStar 日、周字段是否为 *，两者都有限制时满足任意一个即可（与 crontab 一致）
+	domStar bool
+	dowStar bool
+}
+
+// Parse 解析标准 5 段 cron 表达式：分 时 日 月 周，支持 *、a-b、*/n、a-b/n、逗号列表、月份和星期英文缩写，
+// 以及 @yearly/@monthly/@weekly/@daily/@hourly 等预定义表达式；周字段 7 等同于 0（周日）
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("cron spec should have 5 fields, spec:" + spec)
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteRange); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hourRange); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], domRange); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], monthRange); err != nil {
+		return nil, err
+	}
+	// 周字段允许 7 表示周日
+	dow := fieldRange{min: 0, max: 7, names: dowRange.names}
+	if s.dow, err = parseField(fields[4], dow); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return s, nil
+}
+
+// parseField 解析单个字段，返回允许取值的 bit 位
+func parseField(field string, r fieldRange) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		// 1、拆分步长
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.New("invalid step:" + part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		// 2、解析区间，a/n 表示从 a 开始到最大值
+		start, end := r.min, r.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], r); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], r); err != nil {
+				return 0, err
+			}
+		default:
+			n, err := parseValue(part, r)
+			if err != nil {
+				return 0, err
+			}
+			start, end = n, n
+			if step > 1 {
+				end = r.max
+			}
+		}
+		if start > end {
+			return 0, errors.New("invalid range:" + part)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// parseValue 解析单个取值，支持英文缩写
+func parseValue(s string, r fieldRange) (int, error) {
+	if n, ok := r.names[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < r.min || n > r.max {
+		return 0, errors.New("invalid value:" + s)
+	}
+
+	return n, nil
+}
+
+// Next 返回 t 之后（不含 t）的下一次触发时间，精确到分钟，使用 t 的时区；不会再触发时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + maxSearchYears
+
+	// 从月到分逐级匹配，高位字段变化时低位字段归零后重新匹配
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t
+}
+
+// dayMatches 日、周字段是否匹配；两者都有限制时满足任意一个即可
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
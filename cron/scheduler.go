@@ -0,0 +1,469 @@
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/lock"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// redis key 前缀
+const (
+	// cronPrefix 任务执行锁 key 前缀，完整 key 为 cron_<name>，每个任务一个锁
+	cronPrefix = "cron_"
+	// lastPrefix 任务最近一次被执行的触发时间 key 前缀
+	lastPrefix = "cron_last_"
+	// historyPrefix 任务执行记录 key 前缀
+	historyPrefix = "cron_history_"
+)
+
+// 错过执行（调度器停止、进程卡顿等导致触发时间已过去太久）的处理策略
+const (
+	// MissedSkip 跳过错过的触发，只打印告警日志
+	MissedSkip = "skip"
+	// MissedCatchUp 补执行错过的触发，调度器启动时从集群最近一次执行的触发时间开始补
+	MissedCatchUp = "catchup"
+)
+
+const (
+	// defaultHistoryLen 每个任务保留的执行记录条数默认值
+	defaultHistoryLen = 100
+	// defaultMaxCatchUp 最多补执行的触发次数默认值
+	defaultMaxCatchUp = 10
+	// missedGrace 触发时间过去超过该时间才视为错过，单位：秒
+	missedGrace = 60
+	// lockTimeout 执行锁租约时间，单位：秒；执行期间看门狗续期，执行完成后释放
+	lockTimeout = 60
+)
+
+// claimScript 触发时间比最近一次执行的触发时间新时记录并返回 1，否则返回 0；
+// 执行锁释放后时钟偏慢的节点再次抢到锁时，通过该记录避免同一次触发重复执行
+var claimScript = redis.NewScript(1, `
+local last = tonumber(redis.call("GET", KEYS[1]) or "0")
+if last >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return 1
+`)
+
+// SchedulerConf 调度器配置结构
+type SchedulerConf struct {
+	// Host/Port/Passwd redis 地址和密码
+	Host   string
+	Port   string
+	Passwd string
+	// Pool 共享的 redis 连接池，不为空时忽略 Host/Port/Passwd
+	Pool *redis.Pool
+	// Location cron 表达式使用的时区，为空时使用本地时区；集群内所有节点需要一致
+	Location *time.Location
+	// Node 节点标识，记录在执行记录中，需要在集群内唯一，为空时使用 主机名-进程号
+	Node string
+	// HistoryLen 每个任务保留的执行记录条数，为 0 默认 100
+	HistoryLen int
+}
+
+// JobConf 任务配置结构
+type JobConf struct {
+	// Name 任务名称，集群内同名任务的同一次触发只会在一个节点上执行；
+	// 同名任务同一时间只有一个执行，上一次执行没有结束时新的触发被跳过
+	Name string
+	// Spec cron 表达式，见 Parse
+	Spec string
+	// Timeout 单次执行超时时间，单位：秒，为 0 不限制；超时后 Func 的 ctx 被 cancel
+	Timeout int
+	// Jitter 触发后随机等待 [0, Jitter) 再抢执行锁，单位：毫秒，用于打散各节点的请求
+	Jitter int
+	// Missed 错过执行的处理策略，MissedSkip 或 MissedCatchUp，为空默认 MissedSkip
+	Missed string
+	// MaxCatchUp 最多补执行最近的多少次触发，为 0 默认 10
+	MaxCatchUp int
+	// Func 任务函数，ctx 在超时、调度器停止或执行锁丢失时被 cancel
+	Func func(ctx context.Context) error
+}
+
+// RunRecord 任务执行记录
+type RunRecord struct {
+	// Fire 触发时间，unix 时间戳（秒）
+	Fire int64 `json:"fire"`
+	// Node 执行节点
+	Node string `json:"node"`
+	// Start 开始执行时间，unix 时间戳（毫秒）
+	Start int64 `json:"start"`
+	// Duration 执行耗时，单位：毫秒
+	Duration int64 `json:"duration"`
+	// CatchUp 是否为补执行
+	CatchUp bool `json:"catchup,omitempty"`
+	// Err 执行错误，成功时为空
+	Err string `json:"err,omitempty"`
+}
+
+// job 已注册的任务
+type job struct {
+	conf     JobConf
+	schedule *Schedule
+}
+
+// Scheduler 分布式定时任务调度器：每个节点都按 cron 表达式计算触发时间，
+// 每次触发通过 lock 包的分布式锁和最近一次执行的触发时间保证只有一个节点执行，执行记录通过 store 保存在 redis 中
+type Scheduler struct {
+	conf    SchedulerConf
+	pool    *redis.Pool
+	ownPool bool
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler 获取调度器，通过 AddJob 注册任务，调用 Start 开始调度
+func NewScheduler(conf SchedulerConf) (*Scheduler, error) {
+	if conf.Pool == nil && (conf.Host == "" || conf.Port == "") {
+		logrus.Warnf("NewScheduler params err")
+		return nil, errors.New("params err")
+	}
+	if conf.Location == nil {
+		conf.Location = time.Local
+	}
+	if conf.Node == "" {
+		hostname, _ := os.Hostname()
+		conf.Node = hostname + "-" + strconv.Itoa(os.Getpid())
+	}
+	if conf.HistoryLen <= 0 {
+		conf.HistoryLen = defaultHistoryLen
+	}
+
+	s := &Scheduler{conf: conf, pool: conf.Pool, jobs: make(map[string]*job)}
+	if s.pool == nil {
+		pool, err := store.NewRedisPool(store.RedisPoolConf{Host: conf.Host, Port: conf.Port, Passwd: conf.Passwd})
+		if err != nil {
+			return nil, err
+		}
+		s.pool, s.ownPool = pool, true
+	}
+
+	return s, nil
+}
+
+// AddJob 注册任务，调度器运行中注册时立即开始调度；任务名称不能重复
+func (s *Scheduler) AddJob(conf JobConf) error {
+	if conf.Name == "" || conf.Func == nil {
+		logrus.Warnf("AddJob params err")
+		return errors.New("params err")
+	}
+	if conf.Missed == "" {
+		conf.Missed = MissedSkip
+	}
+	if conf.Missed != MissedSkip && conf.Missed != MissedCatchUp {
+		return errors.New("invalid missed policy:" + conf.Missed)
+	}
+	if conf.MaxCatchUp <= 0 {
+		conf.MaxCatchUp = defaultMaxCatchUp
+	}
+	schedule, err := Parse(conf.Spec)
+	if err != nil {
+		logrus.Warnf("parse cron spec err, name:%s, spec:%s, err:%s", conf.Name, conf.Spec, err.Error())
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[conf.Name]; ok {
+		return errors.New("job already exists, name:" + conf.Name)
+	}
+	j := &job{conf: conf, schedule: schedule}
+	s.jobs[conf.Name] = j
+	if s.ctx != nil {
+		s.wg.Add(1)
+		go s.loop(s.ctx, j)
+	}
+
+	return nil
+}
+
+// Start 开始调度全部任务，不阻塞
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx != nil {
+		logrus.Warnf("scheduler already started")
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(s.ctx, j)
+	}
+}
+
+// Stop 停止调度，cancel 执行中任务的 ctx 并等待其退出；停止后可以重新 Start
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.ctx, s.cancel = nil, nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Close 停止调度并关闭调度器自己创建的连接池
+func (s *Scheduler) Close() error {
+	s.Stop()
+	if s.ownPool {
+		return s.pool.Close()
+	}
+
+	return nil
+}
+
+// History 获取任务最近 n 条执行记录，按时间倒序
+func (s *Scheduler) History(name string, n int) ([]RunRecord, error) {
+	if name == "" || n <= 0 {
+		return nil, errors.New("params err")
+	}
+
+	cli, err := store.NewRedisFromPool(s.pool)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	values, err := cli.LRange(historyPrefix+name, 0, n-1)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]RunRecord, 0, len(values))
+	for _, value := range values {
+		record := RunRecord{}
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			logrus.Warnf("unmarshal run record err, name:%s, err:%s", name, err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// loop 单个任务的调度协程，等待到触发时间后分发执行
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+
+	// 1、补执行策略从集群最近一次执行的触发时间开始计算，否则从当前时间开始
+	cursor := time.Now().In(s.conf.Location)
+	if j.conf.Missed == MissedCatchUp {
+		last, err := s.lastFire(j.conf.Name)
+		if err != nil {
+			logrus.Warnf("get cron last fire err, name:%s, err:%s", j.conf.Name, err.Error())
+		} else if last > 0 {
+			cursor = time.Unix(last, 0).In(s.conf.Location)
+		}
+	}
+
+	for {
+		next := j.schedule.Next(cursor)
+		if next.IsZero() {
+			logrus.Warnf("cron job will never fire, name:%s, spec:%s", j.conf.Name, j.conf.Spec)
+			return
+		}
+
+		// 2、等待到触发时间
+		if d := time.Until(next); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 3、收集到当前时间为止的全部触发，进程卡顿或补执行时可能有多次
+		now := time.Now().In(s.conf.Location)
+		var fires []time.Time
+		dropped := 0
+		for t := next; !t.IsZero() && !t.After(now); t = j.schedule.Next(t) {
+			if len(fires) > j.conf.MaxCatchUp {
+				fires = fires[1:]
+				dropped++
+			}
+			fires = append(fires, t)
+			cursor = t
+		}
+		if dropped > 0 {
+			logrus.Warnf("cron job missed runs dropped, name:%s, count:%d", j.conf.Name, dropped)
+		}
+		s.dispatch(ctx, j, fires, now)
+	}
+}
+
+// dispatch 按错过执行策略处理本轮触发，在新协程中依次执行，不阻塞调度
+func (s *Scheduler) dispatch(ctx context.Context, j *job, fires []time.Time, now time.Time) {
+	var missed, due []time.Time
+	for _, fire := range fires {
+		if now.Sub(fire) > missedGrace*time.Second {
+			missed = append(missed, fire)
+		} else {
+			due = append(due, fire)
+		}
+	}
+
+	if len(missed) > 0 && j.conf.Missed == MissedSkip {
+		logrus.Warnf("cron job missed runs skipped, name:%s, count:%d, first:%s", j.conf.Name, len(missed), missed[0])
+		missed = nil
+	}
+	if len(missed) > j.conf.MaxCatchUp {
+		logrus.Warnf("cron job missed runs dropped, name:%s, count:%d", j.conf.Name, len(missed)-j.conf.MaxCatchUp)
+		missed = missed[len(missed)-j.conf.MaxCatchUp:]
+	}
+	if len(missed) == 0 && len(due) == 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for _, fire := range missed {
+			s.fire(ctx, j, fire, true)
+		}
+		for _, fire := range due {
+			s.fire(ctx, j, fire, false)
+		}
+	}()
+}
+
+// fire 执行一次触发：抢到任务的执行锁并且该次触发没有被执行过时才执行
+func (s *Scheduler) fire(ctx context.Context, j *job, fire time.Time, catchUp bool) {
+	name := j.conf.Name
+
+	// 1、随机等待，打散各节点抢锁请求
+	if j.conf.Jitter > 0 {
+		timer := time.NewTimer(time.Duration(rand.Intn(j.conf.Jitter)) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+
+	// 2、抢任务的执行锁，抢不到说明其他节点在执行本次或上一次触发；锁 key 固定，不会随触发次数增长
+	l, err := lock.NewTryLockFromPool(s.pool, cronPrefix+name, s.conf.Node, lockTimeout)
+	if err != nil {
+		return
+	}
+	defer l.Close()
+	l.SetPurpose("cron " + name)
+	if ok, err := l.TryLock(); err != nil || !ok {
+		return
+	}
+	defer func() {
+		if err := l.UnLock(); err != nil {
+			logrus.Warnf("cron unlock err, name:%s, err:%s", name, err.Error())
+		}
+	}()
+
+	// 3、记录最近一次执行的触发时间，已经执行过（或更晚的触发已执行）时跳过
+	if ok, err := s.claim(name, fire); err != nil || !ok {
+		return
+	}
+
+	// 4、执行任务，执行期间看门狗续期执行锁
+	runCtx := l.Watch(ctx)
+	if j.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, time.Duration(j.conf.Timeout)*time.Second)
+		defer cancel()
+	}
+	start := time.Now()
+	err = call(runCtx, j.conf.Func)
+
+	record := RunRecord{
+		Fire:     fire.Unix(),
+		Node:     s.conf.Node,
+		Start:    start.UnixNano() / int64(time.Millisecond),
+		Duration: time.Since(start).Milliseconds(),
+		CatchUp:  catchUp,
+	}
+	if err != nil {
+		record.Err = err.Error()
+		logrus.Warnf("cron job run err, name:%s, fire:%s, err:%s", name, fire, err.Error())
+	}
+	s.addHistory(name, record)
+}
+
+// claim 记录最近一次执行的触发时间，返回 false 表示该次触发已经被执行过
+func (s *Scheduler) claim(name string, fire time.Time) (bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	ret, err := redis.Int(claimScript.Do(conn, lastPrefix+name, fire.Unix()))
+	if err != nil {
+		logrus.Warnf("cron claim script err, name:%s, err:%s", name, err.Error())
+		return false, err
+	}
+
+	return ret == 1, nil
+}
+
+// lastFire 集群最近一次执行的触发时间，没有记录时返回 0
+func (s *Scheduler) lastFire(name string) (int64, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	last, err := redis.Int64(conn.Do("GET", lastPrefix+name))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+
+	return last, err
+}
+
+// addHistory 写入执行记录，只保留最近 HistoryLen 条
+func (s *Scheduler) addHistory(name string, record RunRecord) {
+	cli, err := store.NewRedisFromPool(s.pool)
+	if err != nil {
+		return
+	}
+	defer cli.Close()
+
+	data, _ := json.Marshal(record)
+	key := historyPrefix + name
+	if _, err := cli.LPush(key, string(data)); err != nil {
+		return
+	}
+	cli.LTrim(key, 0, s.conf.HistoryLen-1)
+}
+
+// call 调用任务函数，panic 转换为 error
+func call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Warnf("cron job panic, err:%v, stack:%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
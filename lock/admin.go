@@ -0,0 +1,284 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// auditKey 强制释放审计记录 list，保留最近 auditMaxLen 条；不使用锁的 key 前缀，避免与名为 audit 的锁冲突
+const auditKey = "lock_admin_audit"
+
+// auditMaxLen 审计记录最大条数
+const auditMaxLen = 1000
+
+// scanCount SCAN 每次扫描的 key 数量
+const scanCount = 200
+
+// LockInfo 锁持有信息
+type LockInfo struct {
+	// Key 锁名称，不含 try_lock_ 前缀
+	Key string `json:"key"`
+	// Holder 持有者标识（加锁时的 value）
+	Holder string `json:"holder"`
+	// TTL 锁剩余过期时间
+	TTL time.Duration `json:"ttl"`
+	// Hostname/Pid/AcquiredAt/Purpose 持有者信息，旧版本加的锁没有这些信息
+	Hostname   string    `json:"hostname"`
+	Pid        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	Purpose    string    `json:"purpose"`
+}
+
+// AuditRecord 强制释放审计记录
+type AuditRecord struct {
+	Key      string    `json:"key"`
+	Holder   string    `json:"holder"`
+	Hostname string    `json:"hostname"`
+	Pid      int       `json:"pid"`
+	Operator string    `json:"operator"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+}
+
+// forceReleaseScript 删除锁和持有者信息并发布释放通知，返回被释放的持有者标识，锁不存在时返回 nil
+var forceReleaseScript = redis.NewScript(2, `
+local value = redis.call("GET", KEYS[1])
+if value == false then
+	return false
+end
+redis.call("DEL", KEYS[1], KEYS[2])
+redis.call("PUBLISH", KEYS[1] .. ARGV[1], "1")
+return value
+`)
+
+// Admin 锁管理对象，用于排查锁的持有者、强制释放卡住的锁
+type Admin struct {
+	pool    *redis.Pool
+	ownPool bool
+}
+
+// NewAdmin 获取锁管理对象；需要鉴权、指定 DB 或 TLS 时使用 NewAdminFromConf 或 NewAdminFromPool
+func NewAdmin(host string, port string) (*Admin, error) {
+	return NewAdminFromConf(store.RedisPoolConf{Host: host, Port: port})
+}
+
+// NewAdminFromConf 按连接池配置获取锁管理对象，不再使用时需要调用 Close 关闭连接池
+func NewAdminFromConf(conf store.RedisPoolConf) (*Admin, error) {
+	pool, err := store.NewRedisPool(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查 redis 是否可用，命令行工具可以尽早报错
+	conn := pool.Get()
+	_, err = conn.Do("PING")
+	conn.Close()
+	if err != nil {
+		logrus.Warnf("redis PING err, err:%s", err.Error())
+		pool.Close()
+		return nil, err
+	}
+
+	return &Admin{pool: pool, ownPool: true}, nil
+}
+
+// NewAdminFromPool 基于共享的 redis 连接池获取锁管理对象，连接池由调用方管理
+func NewAdminFromPool(pool *redis.Pool) (*Admin, error) {
+	if pool == nil {
+		logrus.Warnf("NewAdminFromPool params err")
+		return nil, errors.New("params err")
+	}
+
+	return &Admin{pool: pool}, nil
+}
+
+// do 执行 redis 命令
+func (admin *Admin) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := admin.pool.Get()
+	defer conn.Close()
+
+	return conn.Do(cmd, args...)
+}
+
+// eval 执行 lua 脚本
+func (admin *Admin) eval(script *redis.Script, args ...interface{}) (interface{}, error) {
+	conn := admin.pool.Get()
+	defer conn.Close()
+
+	return script.Do(conn, args...)
+}
+
+// List 按前缀列出当前被持有的锁，prefix 不含 try_lock_ 前缀，为空时列出全部
+func (admin *Admin) List(prefix string) ([]LockInfo, error) {
+	var infos []LockInfo
+	cursor := 0
+	for {
+		values, err := redis.Values(admin.do("SCAN", cursor, "MATCH", prefixKey+prefix+"*", "COUNT", scanCount))
+		if err != nil {
+			logrus.Warnf("SCAN err, prefix:%s, err:%s", prefix, err.Error())
+			return nil, err
+		}
+		if cursor, err = redis.Int(values[0], nil); err != nil {
+			return nil, err
+		}
+		keys, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if strings.HasSuffix(key, metaSuffix) || strings.HasSuffix(key, fenceSuffix) {
+				continue
+			}
+			info, err := admin.Get(strings.TrimPrefix(key, prefixKey))
+			if err == ErrLockExpired {
+				continue
+			}
+			if err != nil {
+				// 非字符串类型（读写锁、信号量等内部 key）跳过
+				if _, ok := err.(redis.Error); ok {
+					continue
+				}
+				return nil, err
+			}
+			infos = append(infos, *info)
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return infos, nil
+}
+
+// Get 获取锁的持有信息，锁不存在时返回 ErrLockExpired
+func (admin *Admin) Get(key string) (*LockInfo, error) {
+	fullKey := prefixKey + key
+
+	// 1、持有者标识和剩余过期时间，没有过期时间的 key 不是锁
+	holder, err := redis.String(admin.do("GET", fullKey))
+	if err == redis.ErrNil {
+		return nil, ErrLockExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	pttl, err := redis.Int64(admin.do("PTTL", fullKey))
+	if err != nil {
+		return nil, err
+	}
+	if pttl < 0 {
+		return nil, ErrLockExpired
+	}
+
+	// 2、持有者信息
+	meta, err := redis.StringMap(admin.do("HGETALL", fullKey+metaSuffix))
+	if err != nil {
+		logrus.Warnf("HGETALL err, key:%s, err:%s", fullKey+metaSuffix, err.Error())
+		return nil, err
+	}
+	info := &LockInfo{
+		Key:      key,
+		Holder:   holder,
+		TTL:      time.Duration(pttl) * time.Millisecond,
+		Hostname: meta["hostname"],
+		Purpose:  meta["purpose"],
+	}
+	info.Pid, _ = strconv.Atoi(meta["pid"])
+	if ts, err := strconv.ParseInt(meta["acquired_at"], 10, 64); err == nil {
+		info.AcquiredAt = time.Unix(ts, 0)
+	}
+
+	return info, nil
+}
+
+// ForceRelease 强制释放锁，不校验持有者，同时记录审计日志；锁不存在时返回 ErrLockExpired。
+// 原持有者的看门狗会在下次续期时发现锁已丢失并 cancel 其 ctx
+func (admin *Admin) ForceRelease(key string, operator string, reason string) error {
+	if key == "" || operator == "" {
+		return errors.New("params err")
+	}
+
+	// 1、先读取持有者信息用于审计，再删除
+	info, err := admin.Get(key)
+	if err != nil {
+		return err
+	}
+	fullKey := prefixKey + key
+	holder, err := redis.String(admin.eval(forceReleaseScript, fullKey, fullKey+metaSuffix, releaseSuffix))
+	if err == redis.ErrNil {
+		return ErrLockExpired
+	}
+	if err != nil {
+		logrus.Warnf("force release script err, key:%s, err:%s", fullKey, err.Error())
+		return err
+	}
+
+	// 2、审计日志，同时写入 redis 方便集中查看
+	record := AuditRecord{
+		Key:      key,
+		Holder:   holder,
+		Hostname: info.Hostname,
+		Pid:      info.Pid,
+		Operator: operator,
+		Reason:   reason,
+		Time:     time.Now(),
+	}
+	logrus.WithFields(logrus.Fields{
+		"lock":     key,
+		"holder":   holder,
+		"hostname": info.Hostname,
+		"pid":      info.Pid,
+		"operator": operator,
+		"reason":   reason,
+	}).Warn("lock force released")
+
+	data, _ := json.Marshal(record)
+	if _, err := admin.do("LPUSH", auditKey, data); err != nil {
+		logrus.Warnf("LPUSH audit err, key:%s, err:%s", key, err.Error())
+		return nil
+	}
+	admin.do("LTRIM", auditKey, 0, auditMaxLen-1)
+
+	return nil
+}
+
+// Audit 最近 n 条强制释放审计记录，按时间倒序
+func (admin *Admin) Audit(n int) ([]AuditRecord, error) {
+	if n <= 0 {
+		n = auditMaxLen
+	}
+	values, err := redis.ByteSlices(admin.do("LRANGE", auditKey, 0, n-1))
+	if err != nil {
+		logrus.Warnf("LRANGE audit err, err:%s", err.Error())
+		return nil, err
+	}
+
+	records := make([]AuditRecord, 0, len(values))
+	for _, v := range values {
+		var record AuditRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Close 关闭锁管理对象自己创建的连接池
+func (admin *Admin) Close() error {
+	if admin.ownPool {
+		return admin.pool.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// electionPrefix 选主 key 前缀，与普通锁区分
+const electionPrefix = "election_"
+
+// defaultRetryInterval 竞选重试间隔默认值，单位：毫秒
+const defaultRetryInterval = 1000
+
+// ElectionConf 选主配置结构
+type ElectionConf struct {
+	// Host/Port redis 地址
+	Host string
+	Port string
+	// Pool 共享的 redis 连接池，不为空时忽略 Host/Port
+	Pool *redis.Pool
+	// Name 选主名称，同名的候选者竞争同一个 leader
+	Name string
+	// Identity 候选者标识，为空时自动生成（主机名-进程号-随机串）
+	Identity string
+	// Timeout leader 租约时间，单位：秒，leader 每 Timeout/3 续期一次，异常退出后最多 Timeout 完成切换
+	Timeout int
+	// RetryInterval 非 leader 竞选重试间隔，单位：毫秒，为 0 默认 1000
+	RetryInterval int
+
+	// OnStartedLeading 成为 leader 时在新协程中调用，ctx 在失去 leader 身份时被 cancel，需要监听 ctx.Done() 及时退出；
+	// 返回之前不会主动释放锁，也不会回调 OnStoppedLeading；ctx 结束后已不再续期，需尽快返回，超过租约时间后锁可能被其他候选者获取
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading 失去 leader 身份时调用（包括主动 Resign）
+	OnStoppedLeading func()
+	// OnNewLeader 观察到 leader 变化时调用，identity 为空表示当前没有 leader
+	OnNewLeader func(identity string)
+}
+
+// Election 基于 redis 锁和看门狗续期的选主组件，同一时刻最多一个候选者成为 leader
+type Election struct {
+	conf ElectionConf
+	lock *tryLock
+
+	isLeader int32
+
+	leaderMu sync.RWMutex
+	leader   string
+
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewElection 获取选主对象，调用 Run 开始竞选
+func NewElection(conf ElectionConf) (*Election, error) {
+	if conf.Name == "" {
+		logrus.Warnf("NewElection params err")
+		return nil, errors.New("params err")
+	}
+	if conf.Identity == "" {
+		conf.Identity = newOwnerValue()
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = defaultRetryInterval
+	}
+
+	var lock *tryLock
+	var err error
+	if conf.Pool != nil {
+		lock, err = NewTryLockFromPool(conf.Pool, electionPrefix+conf.Name, conf.Identity, conf.Timeout)
+	} else {
+		lock, err = NewTryLock(conf.Host, conf.Port, electionPrefix+conf.Name, conf.Identity, conf.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Election{conf: conf, lock: lock}, nil
+}
+
+// IsLeader 当前候选者是否为 leader，租约丢失（OnStartedLeading 的 ctx 被 cancel）时立即返回 false
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.isLeader) == 1
+}
+
+// Leader 最近一次观察到的 leader 标识，没有 leader 时返回空
+func (e *Election) Leader() string {
+	e.leaderMu.RLock()
+	defer e.leaderMu.RUnlock()
+
+	return e.leader
+}
+
+// Identity 当前候选者标识
+func (e *Election) Identity() string {
+	return e.conf.Identity
+}
+
+// Run 开始竞选，阻塞直到 ctx 结束或调用 Resign；失去 leader 身份后会重新参与竞选，退出前释放 leader 身份
+func (e *Election) Run(ctx context.Context) {
+	e.runMu.Lock()
+	if e.done != nil {
+		e.runMu.Unlock()
+		logrus.Warnf("election already running, name:%s", e.conf.Name)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.cancel, e.done = cancel, done
+	e.runMu.Unlock()
+
+	defer func() {
+		cancel()
+		e.runMu.Lock()
+		e.cancel, e.done = nil, nil
+		e.runMu.Unlock()
+		close(done)
+	}()
+
+	// 订阅锁释放通知，leader 主动释放时立即重新竞选，不必等到下次重试；订阅失败时只按重试间隔轮询
+	var wake <-chan struct{}
+	if ch, stop, err := e.lock.subscribe(); err != nil {
+		logrus.Warnf("election subscribe release err, name:%s, err:%s", e.conf.Name, err.Error())
+	} else {
+		defer stop()
+		wake = ch
+	}
+
+	for {
+		// 1、竞选，失败时观察当前 leader 并等待重试
+		ok, err := e.lock.TryLock()
+		if err != nil {
+			logrus.Warnf("election campaign err, name:%s, err:%s", e.conf.Name, err.Error())
+		}
+		if ok {
+			e.lead(ctx)
+		} else {
+			e.observe()
+		}
+
+		// 2、ctx 结束或 Resign 时退出，否则等待重试间隔或锁释放通知后进入下一轮竞选
+		timer := time.NewTimer(jitter(time.Duration(e.conf.RetryInterval) * time.Millisecond))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+		}
+	}
+}
+
+// Resign 主动放弃 leader 身份并停止竞选，等待 Run 退出，用于优雅退出；未在竞选时直接返回
+func (e *Election) Resign() {
+	e.runMu.Lock()
+	cancel, done := e.cancel, e.done
+	e.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Close 放弃 leader 身份并停止竞选，关闭选主自己创建的连接池，之后不能再调用 Run
+func (e *Election) Close() error {
+	e.Resign()
+
+	return e.lock.Close()
+}
+
+// lead 成为 leader 后开启续期并回调，直到失去 leader 身份或 ctx 结束，退出前释放锁
+func (e *Election) lead(ctx context.Context) {
+	leaderCtx := e.lock.Watch(ctx)
+	atomic.StoreInt32(&e.isLeader, 1)
+	e.setLeader(e.conf.Identity)
+	logrus.Infof("election became leader, name:%s, identity:%s", e.conf.Name, e.conf.Identity)
+
+	// OnStartedLeading 返回之后才释放锁并回调 OnStoppedLeading，避免两个回调同时执行
+	started := make(chan struct{})
+	if e.conf.OnStartedLeading != nil {
+		go func() {
+			defer close(started)
+			e.conf.OnStartedLeading(leaderCtx)
+		}()
+	} else {
+		close(started)
+	}
+	<-leaderCtx.Done()
+
+	// 租约丢失后其他候选者可能已经成为 leader，不等 OnStartedLeading 返回，立即不再报告自己是 leader
+	atomic.StoreInt32(&e.isLeader, 0)
+	e.observe()
+	<-started
+
+	// 锁已丢失时 UnLock 返回 ErrNotOwner/ErrLockExpired，不会误删新 leader 的锁
+	if err := e.lock.UnLock(); err != nil && err != ErrNotOwner && err != ErrLockExpired {
+		logrus.Warnf("election release err, name:%s, err:%s", e.conf.Name, err.Error())
+	}
+	logrus.Infof("election stopped leading, name:%s, identity:%s", e.conf.Name, e.conf.Identity)
+
+	if e.conf.OnStoppedLeading != nil {
+		e.conf.OnStoppedLeading()
+	}
+	e.observe()
+}
+
+// observe 读取当前 leader 标识
+func (e *Election) observe() {
+	leader, err := redis.String(e.lock.do("GET", e.lock.key))
+	if err != nil && err != redis.ErrNil {
+		logrus.Warnf("election observe err, name:%s, err:%s", e.conf.Name, err.Error())
+		return
+	}
+	e.setLeader(leader)
+}
+
+// setLeader 更新 leader 标识，变化时回调 OnNewLeader
+func (e *Election) setLeader(leader string) {
+	e.leaderMu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.leaderMu.Unlock()
+
+	if changed && e.conf.OnNewLeader != nil {
+		e.conf.OnNewLeader(leader)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileLock 基于 flock(2) 的本机文件锁，进程退出时锁自动释放；锁文件中记录持有者标识
+type FileLock struct {
+	path  string
+	value string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileLock 获取文件锁对象，dir 为空时使用系统临时目录
+func NewFileLock(dir string, key string, value string) (*FileLock, error) {
+	if key == "" || value == "" {
+		logrus.Warnf("NewFileLock params err")
+		return nil, errors.New("params err")
+	}
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	return &FileLock{path: filepath.Join(dir, prefixKey+key+".lock"), value: value}, nil
+}
+
+// TryLock 尝试获取文件锁，LOCK_EX|LOCK_NB 非阻塞加锁
+func (lock *FileLock) TryLock() (bool, error) {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.file != nil {
+		return false, nil
+	}
+
+	file, err := os.OpenFile(lock.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		logrus.Warnf("open lock file err, path:%s, err:%s", lock.path, err.Error())
+		return false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		logrus.Warnf("flock err, path:%s, err:%s", lock.path, err.Error())
+		return false, err
+	}
+
+	// 记录持有者标识，方便排查
+	file.Truncate(0)
+	file.WriteAt([]byte(lock.value), 0)
+	lock.file = file
+
+	return true, nil
+}
+
+// Lock 阻塞获取文件锁，直到获取成功或 ctx 结束
+func (lock *FileLock) Lock(ctx context.Context) error {
+	return waitLock(ctx, lockName(strings.TrimSuffix(filepath.Base(lock.path), ".lock")), nil, lock.TryLock)
+}
+
+// UnLock 释放文件锁，未持有时返回 ErrLockExpired；锁文件保留，删除会导致其他进程锁住已删除的文件
+func (lock *FileLock) UnLock() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.file == nil {
+		return ErrLockExpired
+	}
+	defer func() {
+		lock.file.Close()
+		lock.file = nil
+	}()
+
+	lock.file.Truncate(0)
+	if err := syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN); err != nil {
+		logrus.Warnf("flock unlock err, path:%s, err:%s", lock.path, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Close 文件锁没有需要释放的共享资源，实现 Locker 接口；不会释放锁，释放锁使用 UnLock
+func (lock *FileLock) Close() error {
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// errFileLockUnsupported 当前系统不支持 flock
+var errFileLockUnsupported = errors.New("file lock is not supported on this system")
+
+// FileLock 当前系统不支持 flock，所有操作均返回错误
+type FileLock struct{}
+
+// NewFileLock 当前系统不支持 flock
+func NewFileLock(dir string, key string, value string) (*FileLock, error) {
+	return nil, errFileLockUnsupported
+}
+
+// TryLock 当前系统不支持 flock
+func (lock *FileLock) TryLock() (bool, error) {
+	return false, errFileLockUnsupported
+}
+
+// Lock 当前系统不支持 flock
+func (lock *FileLock) Lock(ctx context.Context) error {
+	return errFileLockUnsupported
+}
+
+// UnLock 当前系统不支持 flock
+func (lock *FileLock) UnLock() error {
+	return errFileLockUnsupported
+}
+
+// Close 当前系统不支持 flock
+func (lock *FileLock) Close() error {
+	return nil
+}
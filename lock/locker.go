@@ -0,0 +1,108 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// 锁后端类型
+const (
+	// BackendRedis 基于 redis SET NX 的分布式锁
+	BackendRedis = "redis"
+	// BackendMysql 基于 mysql GET_LOCK/RELEASE_LOCK 的分布式锁
+	BackendMysql = "mysql"
+	// BackendFile 基于 flock(2) 的本机文件锁
+	BackendFile = "file"
+	// BackendMemory 基于内存 map 的进程内锁，主要用于单元测试
+	BackendMemory = "memory"
+)
+
+// Locker 锁接口，不同后端实现相同的加解锁语义，调用方可以通过配置切换后端
+type Locker interface {
+	// TryLock 尝试获取锁；锁被其他持有者持有时返回 false, nil，后端异常时返回 error
+	TryLock() (bool, error)
+	// Lock 阻塞获取锁，直到获取成功或 ctx 结束
+	Lock(ctx context.Context) error
+	// UnLock 释放锁；锁被其他持有者持有时返回 ErrNotOwner，锁已过期或未持有时返回 ErrLockExpired
+	UnLock() error
+	// Close 释放锁对象自己创建的资源（如 redis 连接池），不会释放锁；不再使用时需要调用
+	Close() error
+}
+
+// LockerConf 锁配置结构
+type LockerConf struct {
+	// Backend 后端类型：redis/mysql/file/memory
+	Backend string
+	// Key 锁名称
+	Key string
+	// Value 持有者标识，为空时自动生成
+	Value string
+	// Timeout 锁超时时间，单位：秒，为 0 默认 5 秒；mysql/file 锁随连接/文件关闭释放，不支持超时
+	Timeout int
+
+	// Host/Port redis 地址，Backend 为 redis 时生效
+	Host string
+	Port string
+	// Pool 共享的 redis 连接池，Backend 为 redis 时生效，不为空时忽略 Host/Port
+	Pool *redis.Pool
+
+	// Mysql mysql 对象，Backend 为 mysql 时生效
+	Mysql *store.MysqlCli
+
+	// Dir 锁文件目录，Backend 为 file 时生效，为空默认系统临时目录
+	Dir string
+}
+
+// NewLocker 根据配置获取锁对象，不再使用时需要调用 Close
+func NewLocker(conf LockerConf) (Locker, error) {
+	if conf.Key == "" {
+		return nil, errors.New("params err")
+	}
+	if conf.Value == "" {
+		conf.Value = newOwnerValue()
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultTimeout
+	}
+
+	// 各构造函数失败时返回的是具体类型的 nil 指针，需要显式返回 nil 接口
+	var locker Locker
+	var err error
+	switch conf.Backend {
+	case BackendRedis:
+		if conf.Pool != nil {
+			locker, err = NewTryLockFromPool(conf.Pool, conf.Key, conf.Value, conf.Timeout)
+		} else {
+			locker, err = NewTryLock(conf.Host, conf.Port, conf.Key, conf.Value, conf.Timeout)
+		}
+	case BackendMysql:
+		locker, err = NewMysqlLock(conf.Mysql, conf.Key)
+	case BackendFile:
+		locker, err = NewFileLock(conf.Dir, conf.Key, conf.Value)
+	case BackendMemory:
+		locker, err = NewMemoryLock(conf.Key, conf.Value, conf.Timeout)
+	default:
+		err = errors.New("invalid lock backend:" + conf.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return locker, nil
+}
+
+// newOwnerValue 生成持有者标识：主机名-进程号-随机串
+func newOwnerValue() string {
+	hostname, _ := os.Hostname()
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(b))
+}
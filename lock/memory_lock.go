@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memoryHolder 进程内锁的持有信息
+type memoryHolder struct {
+	value  string
+	expire time.Time
+}
+
+var (
+	// memoryMu 保护 memoryLocks
+	memoryMu sync.Mutex
+	// memoryLocks 进程内全部锁，key 为锁名称
+	memoryLocks = make(map[string]*memoryHolder)
+)
+
+// MemoryLock 基于内存 map 的进程内锁，语义与 redis 锁一致（带超时），主要用于单元测试替换分布式锁
+type MemoryLock struct {
+	key     string
+	value   string
+	timeout int
+}
+
+// NewMemoryLock 获取进程内锁对象
+func NewMemoryLock(key string, value string, timeout int) (*MemoryLock, error) {
+	if key == "" || value == "" {
+		return nil, errors.New("params err")
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &MemoryLock{key: prefixKey + key, value: value, timeout: timeout}, nil
+}
+
+// TryLock 尝试获取进程内锁，锁存在且未过期时返回 false
+func (lock *MemoryLock) TryLock() (bool, error) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	now := time.Now()
+	if holder, ok := memoryLocks[lock.key]; ok && now.Before(holder.expire) {
+		return false, nil
+	}
+	memoryLocks[lock.key] = &memoryHolder{
+		value:  lock.value,
+		expire: now.Add(time.Duration(lock.timeout) * time.Second),
+	}
+
+	return true, nil
+}
+
+// Lock 阻塞获取进程内锁，直到获取成功或 ctx 结束
+func (lock *MemoryLock) Lock(ctx context.Context) error {
+	return waitLock(ctx, lockName(lock.key), nil, lock.TryLock)
+}
+
+// UnLock 释放进程内锁，只有持有者才能释放
+func (lock *MemoryLock) UnLock() error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	holder, ok := memoryLocks[lock.key]
+	if !ok || !time.Now().Before(holder.expire) {
+		delete(memoryLocks, lock.key)
+		return ErrLockExpired
+	}
+	if holder.value != lock.value {
+		return ErrNotOwner
+	}
+	delete(memoryLocks, lock.key)
+
+	return nil
+}
+
+// Close 进程内锁没有需要释放的资源，实现 Locker 接口；不会释放锁
+func (lock *MemoryLock) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package lock
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// 加锁失败原因
+const (
+	// ReasonContended 锁被其他持有者持有
+	ReasonContended = "contended"
+	// ReasonError 后端异常
+	ReasonError = "error"
+	// ReasonTimeout 阻塞等待时 ctx 超时或被取消
+	ReasonTimeout = "timeout"
+)
+
+// holdWarnRatio 没有开启看门狗时，持有时间达到 ttl 的该比例打印告警日志
+const holdWarnRatio = 0.8
+
+// Metrics 锁监控指标接口，name 为锁名称（不含 try_lock_ 前缀），可以对接不同的监控系统
+type Metrics interface {
+	// Attempt 一次加锁尝试
+	Attempt(name string)
+	// Acquired 加锁成功，wait 为阻塞等待耗时，TryLock 时为 0
+	Acquired(name string, wait time.Duration)
+	// Failed 加锁失败，reason 见 ReasonContended/ReasonError/ReasonTimeout
+	Failed(name string, reason string)
+	// Released 释放锁，hold 为持有时长
+	Released(name string, hold time.Duration)
+	// Renewed 续期一次，ok 为是否续期成功
+	Renewed(name string, ok bool)
+}
+
+// nopMetrics 默认不采集指标
+type nopMetrics struct{}
+
+func (nopMetrics) Attempt(name string)                      {}
+func (nopMetrics) Acquired(name string, wait time.Duration) {}
+func (nopMetrics) Failed(name string, reason string)        {}
+func (nopMetrics) Released(name string, hold time.Duration) {}
+func (nopMetrics) Renewed(name string, ok bool)             {}
+
+var (
+	// metricsMu 保护 metrics
+	metricsMu sync.RWMutex
+	// metrics 全局锁监控指标
+	metrics Metrics = nopMetrics{}
+)
+
+// SetMetrics 设置全局锁监控指标，m 为 nil 时关闭采集
+func SetMetrics(m Metrics) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metrics = m
+}
+
+// getMetrics 获取全局锁监控指标
+func getMetrics() Metrics {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+
+	return metrics
+}
+
+// lockName 指标中的锁名称，去掉 try_lock_ 前缀
+func lockName(key string) string {
+	return strings.TrimPrefix(key, prefixKey)
+}
+
+// failReason 一次加锁尝试失败的原因
+func failReason(err error) string {
+	if err != nil {
+		return ReasonError
+	}
+
+	return ReasonContended
+}
@@ -0,0 +1,237 @@
+package lock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBuckets 等待、持有耗时直方图默认分桶，单位：秒
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram 直方图，counts[i] 为落在 buckets[i] 内的次数（非累计）
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// PromMetrics Metrics 的 Prometheus 文本格式实现，指标保存在内存中，通过 WriteTo 或 HTTP 接口输出：
+//
+//	lock_attempts_total{lock}、lock_acquired_total{lock}、lock_failures_total{lock,reason}、
+//	lock_renewals_total{lock,result}、lock_wait_seconds{lock}、lock_hold_seconds{lock}
+type PromMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	attempts map[string]uint64
+	acquired map[string]uint64
+	failures map[[2]string]uint64
+	renewals map[[2]string]uint64
+	wait     map[string]*histogram
+	hold     map[string]*histogram
+}
+
+// NewPromMetrics 获取 Prometheus 文本格式的锁监控指标，buckets 为空时使用默认分桶，单位：秒
+func NewPromMetrics(buckets []float64) *PromMetrics {
+	if len(buckets) == 0 {
+		buckets = defaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PromMetrics{
+		buckets:  buckets,
+		attempts: make(map[string]uint64),
+		acquired: make(map[string]uint64),
+		failures: make(map[[2]string]uint64),
+		renewals: make(map[[2]string]uint64),
+		wait:     make(map[string]*histogram),
+		hold:     make(map[string]*histogram),
+	}
+}
+
+// Attempt 一次加锁尝试
+func (p *PromMetrics) Attempt(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts[name]++
+}
+
+// Acquired 加锁成功
+func (p *PromMetrics) Acquired(name string, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.acquired[name]++
+	p.observe(p.wait, name, wait)
+}
+
+// Failed 加锁失败
+func (p *PromMetrics) Failed(name string, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures[[2]string{name, reason}]++
+}
+
+// Released 释放锁
+func (p *PromMetrics) Released(name string, hold time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.observe(p.hold, name, hold)
+}
+
+// Renewed 续期一次
+func (p *PromMetrics) Renewed(name string, ok bool) {
+	result := "ok"
+	if !ok {
+		result = "fail"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.renewals[[2]string{name, result}]++
+}
+
+// observe 记录一次耗时，调用方需持有 mu
+func (p *PromMetrics) observe(hs map[string]*histogram, name string, d time.Duration) {
+	h, ok := hs[name]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		hs[name] = h
+	}
+
+	v := d.Seconds()
+	for i, bound := range p.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// WriteTo 按 Prometheus 文本格式输出全部指标
+func (p *PromMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	writeCounter(cw, "lock_attempts_total", "Lock acquisition attempts.", p.attempts)
+	writeCounter(cw, "lock_acquired_total", "Lock acquisitions succeeded.", p.acquired)
+	writePairCounter(cw, "lock_failures_total", "Lock acquisition failures by reason.", "reason", p.failures)
+	writePairCounter(cw, "lock_renewals_total", "Lock lease renewals by result.", "result", p.renewals)
+	p.writeHistogram(cw, "lock_wait_seconds", "Time spent waiting to acquire a lock.", p.wait)
+	p.writeHistogram(cw, "lock_hold_seconds", "Time a lock was held before release.", p.hold)
+	if err := cw.w.(*bufio.Writer).Flush(); err != nil {
+		return cw.n, err
+	}
+
+	return cw.n, cw.err
+}
+
+// ServeHTTP 输出指标，可以直接注册为 /metrics 接口
+func (p *PromMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// writeHistogram 输出直方图，bucket 按 le 累计
+func (p *PromMetrics) writeHistogram(w io.Writer, metric string, help string, hs map[string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", metric, help, metric)
+	for _, name := range sortedKeys(hs) {
+		h := hs[name]
+		var cum uint64
+		for i, bound := range p.buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{lock=%s,le=\"%s\"} %d\n", metric, quote(name), formatFloat(bound), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{lock=%s,le=\"+Inf\"} %d\n", metric, quote(name), h.count)
+		fmt.Fprintf(w, "%s_sum{lock=%s} %s\n", metric, quote(name), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{lock=%s} %d\n", metric, quote(name), h.count)
+	}
+}
+
+// writeCounter 输出只有 lock 标签的计数器
+func writeCounter(w io.Writer, metric string, help string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", metric, help, metric)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s{lock=%s} %d\n", metric, quote(name), values[name])
+	}
+}
+
+// writePairCounter 输出 lock 加一个额外标签的计数器
+func writePairCounter(w io.Writer, metric string, help string, label string, values map[[2]string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", metric, help, metric)
+	keys := make([][2]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{lock=%s,%s=%s} %d\n", metric, quote(k[0]), label, quote(k[1]), values[k])
+	}
+}
+
+// sortedKeys 直方图按锁名称排序
+func sortedKeys(hs map[string]*histogram) []string {
+	names := make([]string, 0, len(hs))
+	for name := range hs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// quote 标签值转义：反斜杠、双引号、换行
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+
+	return `"` + s + `"`
+}
+
+// formatFloat 浮点数输出格式
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countWriter 统计写入字节数，记录第一个写入错误
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+// Write io.Writer 接口
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+
+	return n, err
+}
@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// maxMysqlLockName mysql GET_LOCK 锁名称最大长度
+const maxMysqlLockName = 64
+
+// MysqlLock 基于 mysql GET_LOCK/RELEASE_LOCK 的分布式锁；
+// mysql 的锁与会话绑定，持有期间独占一个连接，连接断开时锁自动释放
+type MysqlLock struct {
+	cli  *store.MysqlCli
+	name string
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewMysqlLock 获取 mysql 锁对象
+func NewMysqlLock(cli *store.MysqlCli, key string) (*MysqlLock, error) {
+	if cli == nil || key == "" {
+		logrus.Warnf("NewMysqlLock params err")
+		return nil, errors.New("params err")
+	}
+	name := prefixKey + key
+	if len(name) > maxMysqlLockName {
+		return nil, errors.New("lock name too long, name:" + name)
+	}
+
+	return &MysqlLock{cli: cli, name: name}, nil
+}
+
+// TryLock 尝试获取 mysql 锁，GET_LOCK 等待时间为 0
+func (lock *MysqlLock) TryLock() (bool, error) {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.conn != nil {
+		return false, nil
+	}
+
+	// 1、获取独占连接，锁与该连接的会话绑定
+	conn, err := lock.cli.Conn(context.Background())
+	if err != nil {
+		return false, err
+	}
+
+	// 2、GET_LOCK 返回 1 获取成功，0 被其他会话持有，NULL 出错
+	var ret sql.NullInt64
+	if err := conn.QueryRowContext(context.Background(), "SELECT GET_LOCK(?, 0)", lock.name).Scan(&ret); err != nil {
+		logrus.Warnf("GET_LOCK err, name:%s, err:%s", lock.name, err.Error())
+		discardConn(conn)
+		return false, err
+	}
+	if !ret.Valid {
+		conn.Close()
+		return false, errors.New("GET_LOCK return null, name:" + lock.name)
+	}
+	if ret.Int64 != 1 {
+		conn.Close()
+		return false, nil
+	}
+	lock.conn = conn
+
+	return true, nil
+}
+
+// Lock 阻塞获取 mysql 锁，直到获取成功或 ctx 结束
+func (lock *MysqlLock) Lock(ctx context.Context) error {
+	return waitLock(ctx, lockName(lock.name), nil, lock.TryLock)
+}
+
+// UnLock 释放 mysql 锁并归还连接；
+// RELEASE_LOCK 返回 0 表示锁被其他会话持有，NULL 表示锁不存在
+func (lock *MysqlLock) UnLock() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	if lock.conn == nil {
+		return ErrLockExpired
+	}
+	conn := lock.conn
+	lock.conn = nil
+
+	// RELEASE_LOCK 失败时会话可能仍持有锁，不能归还连接池，直接丢弃连接，会话断开后锁自动释放
+	var ret sql.NullInt64
+	if err := conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", lock.name).Scan(&ret); err != nil {
+		logrus.Warnf("RELEASE_LOCK err, name:%s, err:%s", lock.name, err.Error())
+		discardConn(conn)
+		return err
+	}
+	conn.Close()
+	if !ret.Valid {
+		return ErrLockExpired
+	}
+	if ret.Int64 != 1 {
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// Close mysql 对象由调用方管理，实现 Locker 接口；不会释放锁，持有期间独占的连接在 UnLock 时归还
+func (lock *MysqlLock) Close() error {
+	return nil
+}
+
+// discardConn 让连接池丢弃底层连接后再关闭，避免可能仍持有锁的会话被放回连接池复用
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
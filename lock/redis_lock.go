@@ -1,18 +1,47 @@
 package lock
 
 import (
+	"context"
 	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
 	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
 )
 
-// tryLock 分布式抢占锁对象
+// tryLock 分布式抢占锁对象，可以并发使用
 type tryLock struct {
 	key     string
 	value   string
-	conn    redis.Conn
 	timeout int
+
+	// pool redis 连接池，每次命令从连接池获取连接，看门狗协程和调用方可以同时使用
+	pool *redis.Pool
+	// ownPool 连接池是否由锁自己创建，Close 时只关闭自己创建的连接池
+	ownPool bool
+	// token 本次持有锁获取到的 fencing token，未持有时为 0
+	token int64
+	// acquiredAt 本次加锁成功的时间（UnixNano），用于统计持有时长
+	acquiredAt int64
+	// leaseAt 最近一次加锁或续期成功时发送命令的时间（UnixNano），锁的过期时间不会晚于该时间 + timeout
+	leaseAt int64
+
+	// confMu 保护 notify 和 purpose
+	confMu sync.RWMutex
+	// notify 是否在 Lock 等待时订阅锁释放通知，及时唤醒等待方
+	notify bool
+	// purpose 加锁用途，记录在持有者信息中，方便排查
+	purpose string
+
+	// watchMu 保护看门狗状态和持有时长告警定时器
+	watchMu     sync.Mutex
+	watchCancel context.CancelFunc
+	watchDone   chan struct{}
+	holdTimer   *time.Timer
 }
 
 // prefixKey redis 分布式锁 key 前缀
@@ -21,48 +50,236 @@ const prefixKey = "try_lock_"
 // defaultTimeout redis 分布式锁默认超时时间，单位:秒
 const defaultTimeout = 5
 
-// NewTryLock 基于 redis 实现的分布式抢占锁
+var (
+	// ErrNotOwner 释放锁时锁已被其他持有者持有
+	ErrNotOwner = errors.New("lock is held by another owner")
+	// ErrLockExpired 释放锁时锁已过期（key 不存在）
+	ErrLockExpired = errors.New("lock already expired")
+)
+
+// releaseSuffix 锁释放通知 channel 后缀，UnLock 成功后向 key+releaseSuffix 发布消息
+const releaseSuffix = ":release"
+
+// fenceSuffix fencing token 计数器 key 后缀
+const fenceSuffix = ":fence"
+
+// fenceTimeout fencing token 计数器过期时间，每次加锁成功时刷新，单位：秒；
+// 计数器过期后从 redis 服务端当前时间（微秒）重新开始，仍然大于之前发放的 token
+const fenceTimeout = 30 * 24 * 3600
+
+// metaSuffix 持有者信息 hash key 后缀，记录主机名、进程号、加锁时间、用途，与锁同时过期
+const metaSuffix = ":meta"
+
+// lockScript 加锁成功后对计数器 INCR 得到 fencing token，并记录持有者信息；
+// 计数器不存在时使用 redis 服务端时间（微秒）作为初始值，保证计数器过期后 token 仍然单调递增
+// KEYS：锁、fencing 计数器、持有者信息；返回值：token 加锁成功，0 锁被其他持有者持有
+var lockScript = redis.NewScript(3, `
+redis.replicate_commands()
+if redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[2], "NX") then
+	redis.call("DEL", KEYS[3])
+	redis.call("HMSET", KEYS[3], "hostname", ARGV[3], "pid", ARGV[4], "acquired_at", ARGV[5], "purpose", ARGV[6])
+	redis.call("EXPIRE", KEYS[3], ARGV[2])
+	local token
+	if redis.call("EXISTS", KEYS[2]) == 1 then
+		token = redis.call("INCR", KEYS[2])
+	else
+		local t = redis.call("TIME")
+		token = tonumber(t[1]) * 1000000 + tonumber(t[2])
+		redis.call("SET", KEYS[2], string.format("%d", token))
+	end
+	redis.call("EXPIRE", KEYS[2], ARGV[7])
+	return token
+end
+return 0
+`)
+
+// unlockScript 比较持有者后再删除，避免锁过期后误删其他持有者的锁，删除成功后发布释放通知
+// 返回值：1 删除成功，0 锁被其他持有者持有，-1 锁已过期
+var unlockScript = redis.NewScript(2, `
+local value = redis.call("GET", KEYS[1])
+if value == false then
+	return -1
+end
+if value ~= ARGV[1] then
+	return 0
+end
+redis.call("DEL", KEYS[1], KEYS[2])
+redis.call("PUBLISH", KEYS[1] .. ARGV[2], "1")
+return 1
+`)
+
+// lockPoolMaxIdle NewTryLock 自建连接池的最大空闲连接数，调用方和看门狗各一个
+const lockPoolMaxIdle = 2
+
+// NewTryLock 基于 redis 实现的分布式抢占锁，使用锁自己的连接池，不再使用时需要调用 Close；
+// 需要鉴权、TLS 或多个锁共享连接时使用 NewTryLockFromPool。
+// 每个锁 key 在加锁成功后会保留一个 fencing token 计数器 key，最后一次加锁后 30 天才过期，
+// 因此 key 不要使用无限增长的名称（如带时间戳、请求 id），否则 redis 中的计数器 key 会持续增长
 func NewTryLock(host string, port string, key string, value string, timeout int) (*tryLock, error) {
 	if host == "" || port == "" || key == "" || value == "" {
 		logrus.Warnf("NewRedis params err")
 		return nil, errors.New("params err")
 	}
 
-	// 获取 redis 对象
-	redisCli, err := redis.Dial("tcp", host+":"+port)
+	// 获取 redis 连接池，并检查 redis 是否可用
+	pool, err := store.NewRedisPool(store.RedisPoolConf{Host: host, Port: port, MaxIdle: lockPoolMaxIdle})
 	if err != nil {
-		logrus.Warnf("redis.Dial err, err:%s", err.Error())
+		return nil, err
+	}
+	conn := pool.Get()
+	_, err = conn.Do("PING")
+	conn.Close()
+	if err != nil {
+		logrus.Warnf("redis PING err, err:%s", err.Error())
+		pool.Close()
 		return nil, err
 	}
 
+	lock, err := NewTryLockFromPool(pool, key, value, timeout)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	lock.ownPool = true
+
+	return lock, nil
+}
+
+// NewTryLockFromPool 基于共享的 redis 连接池创建分布式抢占锁，连接池由调用方管理（见 store.NewRedisPool）；
+// key 的命名限制见 NewTryLock
+func NewTryLockFromPool(pool *redis.Pool, key string, value string, timeout int) (*tryLock, error) {
+	if pool == nil || key == "" || value == "" {
+		logrus.Warnf("NewTryLockFromPool params err")
+		return nil, errors.New("params err")
+	}
+
 	if timeout <= 0 {
 		timeout = defaultTimeout
 	}
 	lock := &tryLock{
 		key:     prefixKey + key,
 		value:   value,
-		conn:    redisCli,
 		timeout: timeout,
+		pool:    pool,
 	}
 
 	return lock, nil
 }
 
-// TryLock 尝试获取 redis 锁
-func (lock *tryLock) TryLock() bool {
-	_, err := redis.String(lock.conn.Do("SET", lock.key, lock.value, "EX", lock.timeout, "NX"))
+// SetPurpose 设置加锁用途，下次加锁成功时记录在持有者信息中
+func (lock *tryLock) SetPurpose(purpose string) {
+	lock.confMu.Lock()
+	defer lock.confMu.Unlock()
+
+	lock.purpose = purpose
+}
+
+// Close 停止看门狗，关闭锁自己创建的连接池，不会释放锁
+func (lock *tryLock) Close() error {
+	lock.stopWatch()
+	if lock.ownPool {
+		return lock.pool.Close()
+	}
+
+	return nil
+}
+
+// do 执行 redis 命令
+func (lock *tryLock) do(cmd string, args ...interface{}) (interface{}, error) {
+	conn := lock.pool.Get()
+	defer conn.Close()
+
+	return conn.Do(cmd, args...)
+}
+
+// eval 执行 lua 脚本
+func (lock *tryLock) eval(script *redis.Script, args ...interface{}) (interface{}, error) {
+	conn := lock.pool.Get()
+	defer conn.Close()
+
+	return script.Do(conn, args...)
+}
+
+// TryLock 尝试获取 redis 锁；锁被其他持有者持有时返回 false, nil，redis 异常时返回 error；
+// 获取成功后可以通过 Token 获取本次持有的 fencing token
+func (lock *tryLock) TryLock() (bool, error) {
+	m := getMetrics()
+	name := lockName(lock.key)
+	m.Attempt(name)
+	ok, err := lock.acquire()
+	if !ok {
+		m.Failed(name, failReason(err))
+		return false, err
+	}
+	m.Acquired(name, 0)
+
+	return true, nil
+}
+
+// acquire 执行一次加锁，不采集指标；加锁成功后记录加锁时间，没有开启看门狗时持有时间接近 timeout 打印告警
+func (lock *tryLock) acquire() (bool, error) {
+	lock.confMu.RLock()
+	purpose := lock.purpose
+	lock.confMu.RUnlock()
+
+	// 记录发送加锁命令的时间，看门狗据此计算租约截止时间
+	hostname, _ := os.Hostname()
+	sent := time.Now()
+	token, err := redis.Int64(lock.eval(lockScript, lock.key, lock.key+fenceSuffix, lock.key+metaSuffix,
+		lock.value, lock.timeout, hostname, os.Getpid(), time.Now().Unix(), purpose, fenceTimeout))
 	if err != nil {
-		return false
+		logrus.Warnf("lock script err, key:%s, err:%s", lock.key, err.Error())
+		return false, err
+	}
+	if token == 0 {
+		return false, nil
 	}
+	atomic.StoreInt64(&lock.token, token)
+	atomic.StoreInt64(&lock.acquiredAt, sent.UnixNano())
+	atomic.StoreInt64(&lock.leaseAt, sent.UnixNano())
 
-	return true
+	ttl := time.Duration(lock.timeout) * time.Second
+	warnAfter := time.Duration(float64(ttl) * holdWarnRatio)
+	lock.watchMu.Lock()
+	if lock.holdTimer != nil {
+		lock.holdTimer.Stop()
+	}
+	lock.holdTimer = time.AfterFunc(warnAfter, func() {
+		logrus.Warnf("lock hold time approaching ttl, key:%s, hold:%s, ttl:%s", lock.key, warnAfter, ttl)
+	})
+	lock.watchMu.Unlock()
+
+	return true, nil
 }
 
-// UnLock 释放 redis 锁
-func (lock *tryLock) UnLock() {
-	if _, err := lock.conn.Do("DEL", lock.key); err != nil {
-		logrus.Warnf("DEL err, err:%s", err.Error())
+// Token 本次持有锁的 fencing token，每次获取锁单调递增，未持有时返回 0；
+// 写存储时带上 token，存储侧拒绝比已写入 token 小的请求，避免锁过期后旧持有者的延迟写覆盖新数据
+func (lock *tryLock) Token() int64 {
+	return atomic.LoadInt64(&lock.token)
+}
+
+// UnLock 释放 redis 锁，只有持有者（value 相同）才能释放，同时停止看门狗；
+// 锁被其他持有者持有时返回 ErrNotOwner，锁已过期时返回 ErrLockExpired
+func (lock *tryLock) UnLock() error {
+	lock.stopWatch()
+	atomic.StoreInt64(&lock.token, 0)
+	atomic.StoreInt64(&lock.leaseAt, 0)
+	if acquiredAt := atomic.SwapInt64(&lock.acquiredAt, 0); acquiredAt > 0 {
+		getMetrics().Released(lockName(lock.key), time.Since(time.Unix(0, acquiredAt)))
+	}
+
+	ret, err := redis.Int(lock.eval(unlockScript, lock.key, lock.key+metaSuffix, lock.value, releaseSuffix))
+	if err != nil {
+		logrus.Warnf("unlock script err, key:%s, err:%s", lock.key, err.Error())
+		return err
+	}
+
+	switch ret {
+	case -1:
+		return ErrLockExpired
+	case 0:
+		return ErrNotOwner
 	}
 
-	return
+	return nil
 }
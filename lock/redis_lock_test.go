@@ -0,0 +1,172 @@
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/garyburd/redigo/redis"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// newTestPool 启动 miniredis 并返回连接池，测试结束时关闭
+func newTestPool(t *testing.T) (*miniredis.Miniredis, *redis.Pool) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	pool, err := store.NewRedisPool(store.RedisPoolConf{Host: mr.Host(), Port: mr.Port()})
+	if err != nil {
+		t.Fatalf("NewRedisPool err: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	return mr, pool
+}
+
+// newTestLock 基于连接池创建锁，测试结束时关闭
+func newTestLock(t *testing.T, pool *redis.Pool, key string, value string, timeout int) *tryLock {
+	t.Helper()
+
+	lock, err := NewTryLockFromPool(pool, key, value, timeout)
+	if err != nil {
+		t.Fatalf("NewTryLockFromPool err: %v", err)
+	}
+	t.Cleanup(func() { lock.Close() })
+
+	return lock
+}
+
+func TestNewTryLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	host, port := mr.Host(), mr.Port()
+
+	if _, err := NewTryLock("", port, "k", "v", 5); err == nil {
+		t.Error("NewTryLock with empty host, want err")
+	}
+	lock, err := NewTryLock(host, port, "k", "v", 5)
+	if err != nil {
+		t.Fatalf("NewTryLock err: %v", err)
+	}
+	defer lock.Close()
+	if ok, err := lock.TryLock(); !ok || err != nil {
+		t.Fatalf("TryLock = %v, %v, want true, nil", ok, err)
+	}
+	if got, _ := mr.Get(prefixKey + "k"); got != "v" {
+		t.Errorf("lock value = %q, want v", got)
+	}
+	if ttl := mr.TTL(prefixKey + "k"); ttl != 5*time.Second {
+		t.Errorf("lock ttl = %s, want 5s", ttl)
+	}
+
+	mr.Close()
+	if _, err := NewTryLock(host, port, "k", "v", 5); err == nil {
+		t.Error("NewTryLock with redis down, want err")
+	}
+}
+
+func TestTryLockExclusive(t *testing.T) {
+	_, pool := newTestPool(t)
+	a := newTestLock(t, pool, "k", "a", 5)
+	b := newTestLock(t, pool, "k", "b", 5)
+
+	if ok, err := a.TryLock(); !ok || err != nil {
+		t.Fatalf("a.TryLock = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Fatalf("b.TryLock = %v, %v, want false, nil", ok, err)
+	}
+	if err := a.UnLock(); err != nil {
+		t.Fatalf("a.UnLock err: %v", err)
+	}
+	if ok, err := b.TryLock(); !ok || err != nil {
+		t.Fatalf("b.TryLock after release = %v, %v, want true, nil", ok, err)
+	}
+}
+
+func TestUnLockOwnerSafe(t *testing.T) {
+	mr, pool := newTestPool(t)
+	a := newTestLock(t, pool, "k", "a", 1)
+	b := newTestLock(t, pool, "k", "b", 5)
+
+	// 1、未持有时释放返回 ErrLockExpired
+	if err := a.UnLock(); err != ErrLockExpired {
+		t.Errorf("UnLock without lock = %v, want ErrLockExpired", err)
+	}
+
+	// 2、锁过期后被其他持有者获取，旧持有者释放返回 ErrNotOwner，不会删除新持有者的锁
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock failed")
+	}
+	mr.FastForward(2 * time.Second)
+	if ok, _ := b.TryLock(); !ok {
+		t.Fatal("b.TryLock after expiry failed")
+	}
+	if err := a.UnLock(); err != ErrNotOwner {
+		t.Errorf("a.UnLock = %v, want ErrNotOwner", err)
+	}
+	if got, _ := mr.Get(prefixKey + "k"); got != "b" {
+		t.Errorf("lock value after a.UnLock = %q, want b", got)
+	}
+
+	// 3、锁过期后释放返回 ErrLockExpired
+	mr.FastForward(6 * time.Second)
+	if err := b.UnLock(); err != ErrLockExpired {
+		t.Errorf("b.UnLock after expiry = %v, want ErrLockExpired", err)
+	}
+}
+
+func TestTryLockRedisDown(t *testing.T) {
+	mr, pool := newTestPool(t)
+	lock := newTestLock(t, pool, "k", "a", 5)
+
+	mr.Close()
+	if ok, err := lock.TryLock(); ok || err == nil {
+		t.Errorf("TryLock with redis down = %v, %v, want false, err", ok, err)
+	}
+	if err := lock.UnLock(); err == nil || err == ErrLockExpired || err == ErrNotOwner {
+		t.Errorf("UnLock with redis down = %v, want redis err", err)
+	}
+}
+
+func TestFenceToken(t *testing.T) {
+	mr, pool := newTestPool(t)
+	a := newTestLock(t, pool, "k", "a", 5)
+	b := newTestLock(t, pool, "k", "b", 5)
+
+	// 1、每次加锁 token 单调递增，释放后归零
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock failed")
+	}
+	first := a.Token()
+	if first <= 0 {
+		t.Fatalf("Token = %d, want > 0", first)
+	}
+	a.UnLock()
+	if a.Token() != 0 {
+		t.Errorf("Token after UnLock = %d, want 0", a.Token())
+	}
+	if ok, _ := b.TryLock(); !ok {
+		t.Fatal("b.TryLock failed")
+	}
+	if b.Token() != first+1 {
+		t.Errorf("b.Token = %d, want %d", b.Token(), first+1)
+	}
+	b.UnLock()
+
+	// 2、计数器带过期时间，每次加锁刷新
+	if ttl := mr.TTL(prefixKey + "k" + fenceSuffix); ttl != fenceTimeout*time.Second {
+		t.Errorf("fence ttl = %s, want %ds", ttl, fenceTimeout)
+	}
+
+	// 3、计数器过期后重新发放的 token 仍然大于之前的 token
+	mr.FastForward((fenceTimeout + 1) * time.Second)
+	if mr.Exists(prefixKey + "k" + fenceSuffix) {
+		t.Fatal("fence counter not expired")
+	}
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock after counter expired failed")
+	}
+	if a.Token() <= first+1 {
+		t.Errorf("Token after counter expired = %d, want > %d", a.Token(), first+1)
+	}
+}
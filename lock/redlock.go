@@ -0,0 +1,252 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// redlockNodeTimeout 单个节点连接、读写超时时间，单位：毫秒，需要远小于锁超时时间，避免单个故障节点拖慢加锁
+const redlockNodeTimeout = 50
+
+// redlockDriftFactor 时钟漂移系数，有效时间需要扣除 ttl*redlockDriftFactor + 2ms
+const redlockDriftFactor = 0.01
+
+// redlockNode 单个 redis 节点，使用节点自己的连接池，连接异常时由连接池重新建立
+type redlockNode struct {
+	addr string
+	pool *redis.Pool
+}
+
+// do 从连接池获取连接并在节点上执行 fn
+func (node *redlockNode) do(fn func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	conn := node.pool.Get()
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+// Redlock 基于 N 个独立 redis 节点的分布式锁（Redlock 算法），单个节点故障不影响锁的可用性与互斥性；
+// 在多数节点（N/2+1）上加锁成功且剩余有效时间大于 0 才认为获取成功
+type Redlock struct {
+	key   string
+	value string
+	// ttl 锁超时时间，单位：毫秒
+	ttl int
+
+	nodes  []*redlockNode
+	quorum int
+
+	mu         sync.Mutex
+	validUntil time.Time
+}
+
+// NewRedlock 基于多个独立 redis 节点的 Redlock 分布式锁，addrs 为 host:port 列表，ttl 单位：毫秒；
+// 需要鉴权、指定 DB 或 TLS 时使用 NewRedlockFromConf
+func NewRedlock(addrs []string, key string, value string, ttl int) (*Redlock, error) {
+	confs := make([]store.RedisPoolConf, 0, len(addrs))
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			logrus.Warnf("NewRedlock addr err, addr:%s, err:%s", addr, err.Error())
+			return nil, err
+		}
+		confs = append(confs, store.RedisPoolConf{Host: host, Port: port})
+	}
+
+	return NewRedlockFromConf(confs, key, value, ttl)
+}
+
+// NewRedlockFromConf 基于多个独立 redis 节点的 Redlock 分布式锁，每个节点按 confs 创建自己的连接池，ttl 单位：毫秒；
+// 节点未设置连接、读写超时时间时默认 50ms，不再使用时需要调用 Close 关闭连接池
+func NewRedlockFromConf(confs []store.RedisPoolConf, key string, value string, ttl int) (*Redlock, error) {
+	if len(confs) == 0 || key == "" || value == "" {
+		logrus.Warnf("NewRedlock params err")
+		return nil, errors.New("params err")
+	}
+	if ttl <= 0 {
+		ttl = defaultTimeout * 1000
+	}
+
+	nodes := make([]*redlockNode, 0, len(confs))
+	for _, conf := range confs {
+		if conf.ConnectTimeout <= 0 {
+			conf.ConnectTimeout = redlockNodeTimeout
+		}
+		if conf.ReadTimeout <= 0 {
+			conf.ReadTimeout = redlockNodeTimeout
+		}
+		if conf.WriteTimeout <= 0 {
+			conf.WriteTimeout = redlockNodeTimeout
+		}
+		pool, err := store.NewRedisPool(conf)
+		if err != nil {
+			for _, node := range nodes {
+				node.pool.Close()
+			}
+			return nil, err
+		}
+		nodes = append(nodes, &redlockNode{addr: conf.Host + ":" + conf.Port, pool: pool})
+	}
+
+	return &Redlock{
+		key:    prefixKey + key,
+		value:  value,
+		ttl:    ttl,
+		nodes:  nodes,
+		quorum: len(nodes)/2 + 1,
+	}, nil
+}
+
+// Close 关闭各节点的连接池，不会释放锁
+func (lock *Redlock) Close() error {
+	var firstErr error
+	for _, node := range lock.nodes {
+		if err := node.pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// TryLock 尝试在多数节点上获取锁；未达到多数时释放已获取的节点并返回 false，
+// 因节点异常导致无法达到多数时返回 error
+func (lock *Redlock) TryLock() (bool, error) {
+	// 1、记录开始时间，并发在全部节点上加锁
+	start := time.Now()
+	_, errs := lock.forEach(func(conn redis.Conn) (interface{}, error) {
+		return redis.String(conn.Do("SET", lock.key, lock.value, "PX", lock.ttl, "NX"))
+	})
+
+	// 2、统计加锁成功的节点
+	succ, fail := 0, 0
+	var lastErr error
+	for _, err := range errs {
+		switch err {
+		case nil:
+			succ++
+		case redis.ErrNil:
+		default:
+			fail++
+			lastErr = err
+		}
+	}
+
+	// 3、有效时间 = ttl - 加锁耗时 - 时钟漂移
+	drift := time.Duration(float64(lock.ttl)*redlockDriftFactor)*time.Millisecond + 2*time.Millisecond
+	validity := time.Duration(lock.ttl)*time.Millisecond - time.Since(start) - drift
+	if succ >= lock.quorum && validity > 0 {
+		lock.mu.Lock()
+		lock.validUntil = start.Add(validity)
+		lock.mu.Unlock()
+		return true, nil
+	}
+
+	// 4、加锁失败，释放全部节点，避免残留的锁阻塞其他持有者直到超时
+	lock.release()
+	if fail > len(lock.nodes)-lock.quorum {
+		logrus.Warnf("redlock quorum unavailable, key:%s, fail:%d, err:%s", lock.key, fail, lastErr.Error())
+		return false, lastErr
+	}
+
+	return false, nil
+}
+
+// Lock 阻塞获取锁，直到获取成功或 ctx 结束，重试间隔随机抖动，避免多个客户端同时抢锁导致都达不到多数
+func (lock *Redlock) Lock(ctx context.Context) error {
+	return waitLock(ctx, lockName(lock.key), nil, lock.TryLock)
+}
+
+// UnLock 在全部节点上释放锁；任一节点释放成功即返回 nil，
+// 全部节点都未释放时，锁被其他持有者持有返回 ErrNotOwner，锁已过期返回 ErrLockExpired
+func (lock *Redlock) UnLock() error {
+	lock.mu.Lock()
+	lock.validUntil = time.Time{}
+	lock.mu.Unlock()
+
+	rets, errs := lock.release()
+	released, notOwner, expired := 0, 0, 0
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch rets[i] {
+		case 1:
+			released++
+		case 0:
+			notOwner++
+		case -1:
+			expired++
+		}
+	}
+
+	switch {
+	case released > 0:
+		return nil
+	case notOwner > 0:
+		return ErrNotOwner
+	case expired > 0:
+		return ErrLockExpired
+	}
+	logrus.Warnf("redlock unlock err, key:%s, err:%s", lock.key, lastErr.Error())
+
+	return lastErr
+}
+
+// Validity 锁剩余有效时间，未持有或已过期时返回 0；调用方需要在有效时间内完成临界区操作
+func (lock *Redlock) Validity() time.Duration {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	remain := time.Until(lock.validUntil)
+	if remain < 0 {
+		return 0
+	}
+
+	return remain
+}
+
+// release 在全部节点上执行释放脚本，返回各节点的脚本返回值和错误
+func (lock *Redlock) release() ([]int, []error) {
+	rets, errs := lock.forEach(func(conn redis.Conn) (interface{}, error) {
+		return redis.Int(unlockScript.Do(conn, lock.key, lock.key+metaSuffix, lock.value, releaseSuffix))
+	})
+
+	ints := make([]int, len(rets))
+	for i, node := range lock.nodes {
+		if errs[i] != nil {
+			logrus.Warnf("redlock release err, addr:%s, key:%s, err:%s", node.addr, lock.key, errs[i].Error())
+			continue
+		}
+		ints[i] = rets[i].(int)
+	}
+
+	return ints, errs
+}
+
+// forEach 并发在全部节点上执行 fn，返回各节点的结果和错误
+func (lock *Redlock) forEach(fn func(conn redis.Conn) (interface{}, error)) ([]interface{}, []error) {
+	rets := make([]interface{}, len(lock.nodes))
+	errs := make([]error, len(lock.nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range lock.nodes {
+		wg.Add(1)
+		go func(i int, node *redlockNode) {
+			defer wg.Done()
+			rets[i], errs[i] = node.do(fn)
+		}(i, node)
+	}
+	wg.Wait()
+
+	return rets, errs
+}
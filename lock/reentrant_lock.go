@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// reentrantPrefix 可重入锁 key 前缀，与普通锁区分，避免同名 key 类型冲突
+const reentrantPrefix = "reentrant_"
+
+// reentrantLockScript 锁不存在或持有者为自己时重入次数加 1 并重置过期时间
+// 返回值：重入次数，0 锁被其他持有者持有
+var reentrantLockScript = redis.NewScript(1, `
+if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	local n = redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return n
+end
+return 0
+`)
+
+// reentrantUnlockScript 重入次数减 1，减到 0 时删除锁并发布释放通知
+// 返回值：剩余重入次数，-1 锁已过期，-2 锁被其他持有者持有
+var reentrantUnlockScript = redis.NewScript(1, `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return -2
+end
+local n = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+if n > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	return n
+end
+redis.call("DEL", KEYS[1])
+redis.call("PUBLISH", KEYS[1] .. ARGV[2], "1")
+return 0
+`)
+
+// ReentrantLock 基于 redis hash 的可重入锁，同一持有者（value 相同）可以重复获取 N 次，N 次 UnLock 后才真正释放；
+// 每次获取和释放都会重置过期时间
+type ReentrantLock struct {
+	base *tryLock
+}
+
+// NewReentrantLock 基于 redis 实现的可重入分布式锁
+func NewReentrantLock(host string, port string, key string, value string, timeout int) (*ReentrantLock, error) {
+	base, err := NewTryLock(host, port, reentrantPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReentrantLock{base: base}, nil
+}
+
+// NewReentrantLockFromPool 基于共享的 redis 连接池创建可重入锁
+func NewReentrantLockFromPool(pool *redis.Pool, key string, value string, timeout int) (*ReentrantLock, error) {
+	base, err := NewTryLockFromPool(pool, reentrantPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReentrantLock{base: base}, nil
+}
+
+// Close 关闭锁自己创建的连接池，不会释放锁
+func (lock *ReentrantLock) Close() error {
+	return lock.base.Close()
+}
+
+// EnableNotify 开启锁释放通知，Lock 等待期间锁释放后立即唤醒
+func (lock *ReentrantLock) EnableNotify() {
+	lock.base.EnableNotify()
+}
+
+// TryLock 尝试获取可重入锁；锁被其他持有者持有时返回 false, nil
+func (lock *ReentrantLock) TryLock() (bool, error) {
+	ttl := time.Duration(lock.base.timeout) * time.Second
+	n, err := redis.Int(lock.base.eval(reentrantLockScript, lock.base.key, lock.base.value, ttl.Milliseconds()))
+	if err != nil {
+		logrus.Warnf("reentrant lock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// Lock 阻塞获取可重入锁，直到获取成功或 ctx 结束
+func (lock *ReentrantLock) Lock(ctx context.Context) error {
+	return lock.base.wait(ctx, lock.TryLock)
+}
+
+// UnLock 重入次数减 1，减到 0 时释放锁；
+// 锁被其他持有者持有时返回 ErrNotOwner，锁已过期时返回 ErrLockExpired
+func (lock *ReentrantLock) UnLock() error {
+	ttl := time.Duration(lock.base.timeout) * time.Second
+	n, err := redis.Int(lock.base.eval(reentrantUnlockScript, lock.base.key, lock.base.value, releaseSuffix, ttl.Milliseconds()))
+	if err != nil {
+		logrus.Warnf("reentrant unlock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return err
+	}
+
+	switch n {
+	case -1:
+		return ErrLockExpired
+	case -2:
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// Count 当前持有者的重入次数，未持有时返回 0
+func (lock *ReentrantLock) Count() (int, error) {
+	n, err := redis.Int(lock.base.do("HGET", lock.base.key, lock.base.value))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	if err != nil {
+		logrus.Warnf("HGET err, key:%s, err:%s", lock.base.key, err.Error())
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,83 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReentrantLock(t *testing.T) {
+	mr, pool := newTestPool(t)
+	a, _ := NewReentrantLockFromPool(pool, "k", "a", 5)
+	b, _ := NewReentrantLockFromPool(pool, "k", "b", 5)
+
+	// 1、同一持有者可以重入，其他持有者获取失败
+	for i := 1; i <= 3; i++ {
+		if ok, err := a.TryLock(); !ok || err != nil {
+			t.Fatalf("a.TryLock #%d = %v, %v, want true, nil", i, ok, err)
+		}
+	}
+	if n, _ := a.Count(); n != 3 {
+		t.Errorf("Count = %d, want 3", n)
+	}
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Fatalf("b.TryLock = %v, %v, want false, nil", ok, err)
+	}
+	if err := b.UnLock(); err != ErrNotOwner {
+		t.Errorf("b.UnLock = %v, want ErrNotOwner", err)
+	}
+
+	// 2、N 次 UnLock 后才真正释放
+	for i := 1; i <= 2; i++ {
+		if err := a.UnLock(); err != nil {
+			t.Fatalf("a.UnLock #%d err: %v", i, err)
+		}
+	}
+	if ok, _ := b.TryLock(); ok {
+		t.Fatal("b.TryLock succeeded before the last UnLock")
+	}
+	if err := a.UnLock(); err != nil {
+		t.Fatalf("last a.UnLock err: %v", err)
+	}
+	if mr.Exists(reentrantPrefix + "k") {
+		t.Error("lock key left after last UnLock")
+	}
+	if n, _ := a.Count(); n != 0 {
+		t.Errorf("Count after release = %d, want 0", n)
+	}
+	if err := a.UnLock(); err != ErrLockExpired {
+		t.Errorf("UnLock after release = %v, want ErrLockExpired", err)
+	}
+
+	// 3、过期后其他持有者可以获取
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock failed")
+	}
+	mr.FastForward(6 * time.Second)
+	if ok, _ := b.TryLock(); !ok {
+		t.Error("b.TryLock after expiry failed")
+	}
+}
+
+func TestReentrantLockWait(t *testing.T) {
+	_, pool := newTestPool(t)
+	a, _ := NewReentrantLockFromPool(pool, "k", "a", 5)
+	b, _ := NewReentrantLockFromPool(pool, "k", "b", 5)
+	b.EnableNotify()
+
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock failed")
+	}
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- b.Lock(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	a.UnLock()
+	if err := <-done; err != nil {
+		t.Errorf("b.Lock err: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// runOncePrefix 分布式 singleflight 锁 key 前缀
+const runOncePrefix = "run_once_"
+
+// runOnceResultPrefix 分布式 singleflight 结果 key 前缀
+const runOnceResultPrefix = "run_once_result_"
+
+// runOnceErrTTL 执行出错时结果保留时间，单位：秒，只用于把错误传递给正在等待的节点，之后的调用会重新执行
+const runOnceErrTTL = 1
+
+// runOnceResult 保存在 redis 中的执行结果
+type runOnceResult struct {
+	Value string `json:"value"`
+	Err   string `json:"err,omitempty"`
+}
+
+// RunOnce 分布式 singleflight：同一个 key 同一时刻只有一个节点执行，其他节点等待并获取其结果；
+// 结果在 redis 中保留 resultTTL 秒，期间的调用直接返回该结果；redis 不可用时退化为本地执行
+type RunOnce struct {
+	// pool redis 连接池，执行锁和结果读写共用
+	pool *redis.Pool
+	// resultTTL 结果保留时间，单位：秒
+	resultTTL int
+	// lockTimeout 执行锁超时时间，单位：秒，执行期间由看门狗自动续期
+	lockTimeout int
+}
+
+// NewRunOnce 获取分布式 singleflight 对象，resultTTL 为结果保留时间，lockTimeout 为执行锁超时时间，单位：秒；
+// 不再使用时需要调用 Close 关闭连接池
+func NewRunOnce(host string, port string, passwd string, resultTTL int, lockTimeout int) (*RunOnce, error) {
+	if host == "" || port == "" || resultTTL <= 0 {
+		logrus.Warnf("NewRunOnce params err")
+		return nil, errors.New("params err")
+	}
+	if lockTimeout <= 0 {
+		lockTimeout = defaultTimeout
+	}
+
+	pool, err := store.NewRedisPool(store.RedisPoolConf{Host: host, Port: port, Passwd: passwd})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunOnce{
+		pool:        pool,
+		resultTTL:   resultTTL,
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+// Close 关闭连接池
+func (once *RunOnce) Close() error {
+	return once.pool.Close()
+}
+
+// Do 执行 fn 并返回结果，同一个 key 同一时刻只有一个节点执行；
+// fn 返回的错误同样会传递给等待的节点；redis 不可用时直接在本地执行 fn
+func (once *RunOnce) Do(ctx context.Context, key string, fn func() (string, error)) (string, error) {
+	if key == "" || fn == nil {
+		return "", errors.New("params err")
+	}
+	resultKey := runOnceResultPrefix + key
+
+	// 1、已有结果直接返回
+	result, err := once.getResult(resultKey)
+	if err != nil {
+		logrus.Warnf("run once fallback to local, key:%s, err:%s", key, err.Error())
+		return fn()
+	}
+	if result != nil {
+		return result.decode()
+	}
+
+	lock, err := NewTryLockFromPool(once.pool, runOncePrefix+key, newOwnerValue(), once.lockTimeout)
+	if err != nil {
+		logrus.Warnf("run once fallback to local, key:%s, err:%s", key, err.Error())
+		return fn()
+	}
+	defer lock.Close()
+	lock.EnableNotify()
+
+	// 2、抢执行锁，抢不到时等待执行者写入结果；执行者异常退出（锁过期且没有结果）时重新抢锁
+	locked := false
+	var redisErr error
+	err = lock.wait(ctx, func() (bool, error) {
+		if result, redisErr = once.getResult(resultKey); redisErr != nil || result != nil {
+			return true, nil
+		}
+		// 使用 acquire 而不是 TryLock，加锁指标由 wait 统一采集
+		locked, redisErr = lock.acquire()
+		return locked || redisErr != nil, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if redisErr != nil {
+		logrus.Warnf("run once fallback to local, key:%s, err:%s", key, redisErr.Error())
+		return fn()
+	}
+	if !locked {
+		return result.decode()
+	}
+
+	// 3、抢到执行锁，执行期间看门狗续期，执行完成后写入结果再释放锁
+	lock.Watch(ctx)
+	defer lock.UnLock()
+
+	value, fnErr := fn()
+	once.setResult(resultKey, value, fnErr)
+
+	return value, fnErr
+}
+
+// getResult 读取执行结果，不存在时返回 nil, nil，redis 异常时返回 error
+func (once *RunOnce) getResult(resultKey string) (*runOnceResult, error) {
+	cli, err := store.NewRedisFromPool(once.pool)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	// 结果 key 不存在时 TTL 返回 -2，先判断避免 Get 打印 nil 告警
+	ttl, err := cli.TTL(resultKey)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == -2 {
+		return nil, nil
+	}
+	data, err := cli.Get(resultKey)
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &runOnceResult{}
+	if err := json.Unmarshal([]byte(data), result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// setResult 写入执行结果，出错时只短暂保留用于通知等待的节点
+func (once *RunOnce) setResult(resultKey string, value string, fnErr error) {
+	result := runOnceResult{Value: value}
+	ttl := once.resultTTL
+	if fnErr != nil {
+		result.Err = fnErr.Error()
+		ttl = runOnceErrTTL
+	}
+	data, _ := json.Marshal(result)
+
+	cli, err := store.NewRedisFromPool(once.pool)
+	if err != nil {
+		logrus.Warnf("run once set result err, key:%s, err:%s", resultKey, err.Error())
+		return
+	}
+	defer cli.Close()
+
+	if !cli.SetEX(resultKey, string(data), ttl) {
+		logrus.Warnf("run once set result err, key:%s", resultKey)
+	}
+}
+
+// decode 转换为 Do 的返回值
+func (result *runOnceResult) decode() (string, error) {
+	if result.Err != "" {
+		return result.Value, errors.New(result.Err)
+	}
+
+	return result.Value, nil
+}
@@ -0,0 +1,195 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// rwPrefix 读写锁 key 前缀，与普通锁区分
+const rwPrefix = "rw_"
+
+// rwWaitTTL 写等待标记过期时间，单位：毫秒；等待中的写锁每次重试都会刷新，放弃等待后标记自动过期，不再阻塞读锁
+const rwWaitTTL = 3000
+
+// rLockScript 没有写锁且没有等待中的写锁时获取读锁，已持有读锁的持有者可以重入（避免写等待时死锁）
+// KEYS：读锁 hash、写锁、写等待标记；返回值：1 获取成功，0 获取失败
+var rLockScript = redis.NewScript(3, `
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+if redis.call("EXISTS", KEYS[3]) == 1 and redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return 1
+`)
+
+// rUnlockScript 读锁计数减 1，最后一个读锁释放时发布释放通知
+// 返回值：1 释放成功，0 未持有读锁，-1 读锁已过期
+var rUnlockScript = redis.NewScript(1, `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+if redis.call("HINCRBY", KEYS[1], ARGV[1], -1) <= 0 then
+	redis.call("HDEL", KEYS[1], ARGV[1])
+end
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	redis.call("PUBLISH", ARGV[2], "1")
+end
+return 1
+`)
+
+// wLockScript 没有读锁和写锁时获取写锁并清除自己的等待标记，否则设置等待标记阻止新的读锁（写优先）
+// KEYS：读锁 hash、写锁、写等待标记；返回值：1 获取成功，0 获取失败
+var wLockScript = redis.NewScript(3, `
+if redis.call("EXISTS", KEYS[1]) == 0 and redis.call("EXISTS", KEYS[2]) == 0 then
+	redis.call("SET", KEYS[2], ARGV[1], "PX", ARGV[2])
+	if redis.call("GET", KEYS[3]) == ARGV[1] then
+		redis.call("DEL", KEYS[3])
+	end
+	return 1
+end
+redis.call("SET", KEYS[3], ARGV[1], "PX", ARGV[3])
+return 0
+`)
+
+// wUnlockScript 比较持有者后删除写锁并发布释放通知
+// 返回值：1 释放成功，0 写锁被其他持有者持有，-1 写锁已过期
+var wUnlockScript = redis.NewScript(1, `
+local value = redis.call("GET", KEYS[1])
+if value == false then
+	return -1
+end
+if value ~= ARGV[1] then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+redis.call("PUBLISH", ARGV[2], "1")
+return 1
+`)
+
+// RWLock 基于 redis 的分布式读写锁，允许多个读锁并发或一个写锁独占；
+// 写锁等待期间会设置等待标记阻止新的读锁进入，避免持续的读请求导致写锁饿死。
+// 读锁 hash 的过期时间由全部读持有者共同刷新，异常退出的读持有者需等所有读锁释放后才会过期
+type RWLock struct {
+	base *tryLock
+
+	readKey  string
+	writeKey string
+	waitKey  string
+}
+
+// NewRWLock 基于 redis 实现的分布式读写锁
+func NewRWLock(host string, port string, key string, value string, timeout int) (*RWLock, error) {
+	base, err := NewTryLock(host, port, rwPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRWLock(base), nil
+}
+
+// NewRWLockFromPool 基于共享的 redis 连接池创建读写锁
+func NewRWLockFromPool(pool *redis.Pool, key string, value string, timeout int) (*RWLock, error) {
+	base, err := NewTryLockFromPool(pool, rwPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRWLock(base), nil
+}
+
+// newRWLock 读写锁各 key 以 base.key 为前缀
+func newRWLock(base *tryLock) *RWLock {
+	return &RWLock{
+		base:     base,
+		readKey:  base.key + ":read",
+		writeKey: base.key + ":write",
+		waitKey:  base.key + ":wait",
+	}
+}
+
+// Close 关闭锁自己创建的连接池，不会释放锁
+func (lock *RWLock) Close() error {
+	return lock.base.Close()
+}
+
+// EnableNotify 开启锁释放通知，RLock/Lock 等待期间锁释放后立即唤醒
+func (lock *RWLock) EnableNotify() {
+	lock.base.EnableNotify()
+}
+
+// TryRLock 尝试获取读锁；存在写锁或等待中的写锁时返回 false, nil
+func (lock *RWLock) TryRLock() (bool, error) {
+	ttl := time.Duration(lock.base.timeout) * time.Second
+	ret, err := redis.Int(lock.base.eval(rLockScript, lock.readKey, lock.writeKey, lock.waitKey, lock.base.value, ttl.Milliseconds()))
+	if err != nil {
+		logrus.Warnf("rlock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return false, err
+	}
+
+	return ret == 1, nil
+}
+
+// RLock 阻塞获取读锁，直到获取成功或 ctx 结束
+func (lock *RWLock) RLock(ctx context.Context) error {
+	return lock.base.wait(ctx, lock.TryRLock)
+}
+
+// RUnLock 释放一次读锁；未持有读锁时返回 ErrNotOwner，读锁已过期时返回 ErrLockExpired
+func (lock *RWLock) RUnLock() error {
+	ret, err := redis.Int(lock.base.eval(rUnlockScript, lock.readKey, lock.base.value, lock.base.key+releaseSuffix))
+	if err != nil {
+		logrus.Warnf("runlock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return err
+	}
+
+	return rwUnlockErr(ret)
+}
+
+// TryLock 尝试获取写锁；存在读锁或写锁时返回 false, nil，同时标记写等待
+func (lock *RWLock) TryLock() (bool, error) {
+	ttl := time.Duration(lock.base.timeout) * time.Second
+	ret, err := redis.Int(lock.base.eval(wLockScript, lock.readKey, lock.writeKey, lock.waitKey, lock.base.value, ttl.Milliseconds(), rwWaitTTL))
+	if err != nil {
+		logrus.Warnf("wlock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return false, err
+	}
+
+	return ret == 1, nil
+}
+
+// Lock 阻塞获取写锁，直到获取成功或 ctx 结束
+func (lock *RWLock) Lock(ctx context.Context) error {
+	return lock.base.wait(ctx, lock.TryLock)
+}
+
+// UnLock 释放写锁；写锁被其他持有者持有时返回 ErrNotOwner，写锁已过期时返回 ErrLockExpired
+func (lock *RWLock) UnLock() error {
+	ret, err := redis.Int(lock.base.eval(wUnlockScript, lock.writeKey, lock.base.value, lock.base.key+releaseSuffix))
+	if err != nil {
+		logrus.Warnf("wunlock script err, key:%s, err:%s", lock.base.key, err.Error())
+		return err
+	}
+
+	return rwUnlockErr(ret)
+}
+
+// rwUnlockErr 释放脚本返回值转换为错误
+func rwUnlockErr(ret int) error {
+	switch ret {
+	case -1:
+		return ErrLockExpired
+	case 0:
+		return ErrNotOwner
+	}
+
+	return nil
+}
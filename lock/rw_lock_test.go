@@ -0,0 +1,82 @@
+package lock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRWLockReaders(t *testing.T) {
+	_, pool := newTestPool(t)
+	r1, _ := NewRWLockFromPool(pool, "k", "r1", 5)
+	r2, _ := NewRWLockFromPool(pool, "k", "r2", 5)
+	w, _ := NewRWLockFromPool(pool, "k", "w", 5)
+
+	// 1、读锁可以并发，存在读锁时写锁获取失败
+	if ok, err := r1.TryRLock(); !ok || err != nil {
+		t.Fatalf("r1.TryRLock = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := r2.TryRLock(); !ok || err != nil {
+		t.Fatalf("r2.TryRLock = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := w.TryLock(); ok || err != nil {
+		t.Fatalf("w.TryLock with readers = %v, %v, want false, nil", ok, err)
+	}
+
+	// 2、写等待期间新的读锁获取失败，已持有读锁的持有者可以重入
+	r3, _ := NewRWLockFromPool(pool, "k", "r3", 5)
+	if ok, _ := r3.TryRLock(); ok {
+		t.Error("r3.TryRLock succeeded while a writer is waiting")
+	}
+	if ok, _ := r1.TryRLock(); !ok {
+		t.Error("r1 reentrant TryRLock failed while a writer is waiting")
+	}
+
+	// 3、全部读锁释放后写锁获取成功
+	r1.RUnLock()
+	r1.RUnLock()
+	if ok, _ := w.TryLock(); ok {
+		t.Fatal("w.TryLock succeeded while r2 holds the read lock")
+	}
+	if err := r2.RUnLock(); err != nil {
+		t.Fatalf("r2.RUnLock err: %v", err)
+	}
+	if ok, err := w.TryLock(); !ok || err != nil {
+		t.Fatalf("w.TryLock after readers released = %v, %v, want true, nil", ok, err)
+	}
+	if err := r2.RUnLock(); err != ErrLockExpired {
+		t.Errorf("r2.RUnLock without read lock = %v, want ErrLockExpired", err)
+	}
+}
+
+func TestRWLockWriter(t *testing.T) {
+	mr, pool := newTestPool(t)
+	w1, _ := NewRWLockFromPool(pool, "k", "w1", 5)
+	w2, _ := NewRWLockFromPool(pool, "k", "w2", 5)
+	r, _ := NewRWLockFromPool(pool, "k", "r", 5)
+
+	// 1、写锁独占
+	if ok, _ := w1.TryLock(); !ok {
+		t.Fatal("w1.TryLock failed")
+	}
+	if ok, _ := w2.TryLock(); ok {
+		t.Error("w2.TryLock succeeded while w1 holds the write lock")
+	}
+	if ok, _ := r.TryRLock(); ok {
+		t.Error("r.TryRLock succeeded while w1 holds the write lock")
+	}
+	if err := w2.UnLock(); err != ErrNotOwner {
+		t.Errorf("w2.UnLock = %v, want ErrNotOwner", err)
+	}
+	if err := w1.UnLock(); err != nil {
+		t.Fatalf("w1.UnLock err: %v", err)
+	}
+
+	// 2、放弃等待的写锁标记过期后不再阻塞读锁
+	if ok, _ := r.TryRLock(); ok {
+		t.Fatal("r.TryRLock succeeded while w2 is waiting")
+	}
+	mr.FastForward(rwWaitTTL * time.Millisecond)
+	if ok, _ := r.TryRLock(); !ok {
+		t.Error("r.TryRLock failed after the wait mark expired")
+	}
+}
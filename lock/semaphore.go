@@ -0,0 +1,205 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// semPrefix 信号量 key 前缀，与普通锁区分
+const semPrefix = "sem_"
+
+// semWaiterTTL 等待者心跳过期时间，单位：毫秒；等待者每次重试都会刷新，异常退出的等待者过期后被清理，不再占用排队位置
+const semWaiterTTL = 3000
+
+// semAcquireScript 清理过期持有者和等待者，未排队时领取排队号，排在前 limit-持有数 位时获取成功
+// KEYS：持有者 zset(score 过期时间)、等待者 zset(score 排队号)、等待者心跳 zset(score 过期时间)、排队号计数器
+// ARGV：持有者标识、当前时间、持有过期时间、limit、等待心跳过期时间、获取失败是否退出排队
+// 返回值：1 获取成功，0 获取失败
+var semAcquireScript = redis.NewScript(4, `
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[2])
+local dead = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", ARGV[2])
+for _, id in ipairs(dead) do
+	redis.call("ZREM", KEYS[2], id)
+	redis.call("ZREM", KEYS[3], id)
+end
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+	return 1
+end
+if not redis.call("ZSCORE", KEYS[2], ARGV[1]) then
+	redis.call("ZADD", KEYS[2], redis.call("INCR", KEYS[4]), ARGV[1])
+end
+local rank = redis.call("ZRANK", KEYS[2], ARGV[1])
+if rank < tonumber(ARGV[4]) - redis.call("ZCARD", KEYS[1]) then
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+	redis.call("ZREM", KEYS[2], ARGV[1])
+	redis.call("ZREM", KEYS[3], ARGV[1])
+	return 1
+end
+if ARGV[6] == "1" then
+	redis.call("ZREM", KEYS[2], ARGV[1])
+	redis.call("ZREM", KEYS[3], ARGV[1])
+else
+	redis.call("ZADD", KEYS[3], ARGV[5], ARGV[1])
+end
+return 0
+`)
+
+// semReleaseScript 移除持有者并发布释放通知
+// 返回值：1 释放成功，0 未持有（已过期被清理）
+var semReleaseScript = redis.NewScript(1, `
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	redis.call("PUBLISH", ARGV[2], "1")
+	return 1
+end
+return 0
+`)
+
+// semRenewScript 持有者续期
+// 返回值：1 续期成功，0 未持有
+var semRenewScript = redis.NewScript(1, `
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// Semaphore 基于 redis 的分布式计数信号量，最多 limit 个持有者同时持有，等待者按排队号先来先得；
+// 持有者 timeout 内未释放或续期会被视为异常退出并清理。过期判断使用客户端时间，各机器需要保持时钟同步。
+//
+// 一个 Semaphore 对象只代表一个持有者（value），只占用一个名额：同一个对象重复 Acquire 只会续期已持有的名额，
+// 多个协程共用同一个对象时共享这一个名额，任一协程 Release 都会释放它。需要多个名额时，
+// 每个持有者（协程）各自创建 value 不同的 Semaphore，共享连接池时使用 NewSemaphoreFromPool 创建开销很小
+type Semaphore struct {
+	base  *tryLock
+	limit int
+
+	holdersKey string
+	waitersKey string
+	aliveKey   string
+	ticketKey  string
+}
+
+// NewSemaphore 基于 redis 实现的分布式信号量，value 为持有者标识（不同持有者必须不同），limit 为最大并发数，timeout 为持有超时时间，单位：秒
+func NewSemaphore(host string, port string, key string, value string, limit int, timeout int) (*Semaphore, error) {
+	if limit <= 0 {
+		logrus.Warnf("NewSemaphore params err")
+		return nil, errors.New("params err")
+	}
+	base, err := NewTryLock(host, port, semPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSemaphore(base, limit), nil
+}
+
+// NewSemaphoreFromPool 基于共享的 redis 连接池创建信号量，value 为持有者标识（不同持有者必须不同）
+func NewSemaphoreFromPool(pool *redis.Pool, key string, value string, limit int, timeout int) (*Semaphore, error) {
+	if limit <= 0 {
+		logrus.Warnf("NewSemaphoreFromPool params err")
+		return nil, errors.New("params err")
+	}
+	base, err := NewTryLockFromPool(pool, semPrefix+key, value, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSemaphore(base, limit), nil
+}
+
+// newSemaphore 信号量各 key 以 base.key 为前缀
+func newSemaphore(base *tryLock, limit int) *Semaphore {
+	return &Semaphore{
+		base:       base,
+		limit:      limit,
+		holdersKey: base.key + ":holders",
+		waitersKey: base.key + ":waiters",
+		aliveKey:   base.key + ":alive",
+		ticketKey:  base.key + ":ticket",
+	}
+}
+
+// Close 关闭信号量自己创建的连接池，不会释放信号量
+func (sem *Semaphore) Close() error {
+	return sem.base.Close()
+}
+
+// EnableNotify 开启释放通知，Acquire 等待期间有持有者释放后立即唤醒
+func (sem *Semaphore) EnableNotify() {
+	sem.base.EnableNotify()
+}
+
+// TryAcquire 尝试获取信号量，没有空闲名额或前面有等待者时返回 false, nil，不保留排队位置
+func (sem *Semaphore) TryAcquire() (bool, error) {
+	return sem.acquire(true)
+}
+
+// Acquire 阻塞获取信号量，直到获取成功或 ctx 结束；等待期间保留排队位置，ctx 结束时退出排队
+func (sem *Semaphore) Acquire(ctx context.Context) error {
+	err := sem.base.wait(ctx, func() (bool, error) {
+		return sem.acquire(false)
+	})
+	if err != nil {
+		if _, err := sem.base.do("ZREM", sem.waitersKey, sem.base.value); err != nil {
+			logrus.Warnf("ZREM waiter err, key:%s, err:%s", sem.waitersKey, err.Error())
+		}
+		sem.base.do("ZREM", sem.aliveKey, sem.base.value)
+	}
+
+	return err
+}
+
+// Release 释放信号量，未持有（已过期被清理）时返回 ErrLockExpired
+func (sem *Semaphore) Release() error {
+	ret, err := redis.Int(sem.base.eval(semReleaseScript, sem.holdersKey, sem.base.value, sem.base.key+releaseSuffix))
+	if err != nil {
+		logrus.Warnf("semaphore release script err, key:%s, err:%s", sem.base.key, err.Error())
+		return err
+	}
+	if ret == 0 {
+		return ErrLockExpired
+	}
+
+	return nil
+}
+
+// Renew 续期，将持有过期时间重置为 timeout，执行时间较长的任务需要定期调用；未持有时返回 ErrLockExpired
+func (sem *Semaphore) Renew() error {
+	expireAt := time.Now().Add(time.Duration(sem.base.timeout)*time.Second).UnixNano() / int64(time.Millisecond)
+	ret, err := redis.Int(sem.base.eval(semRenewScript, sem.holdersKey, sem.base.value, expireAt))
+	if err != nil {
+		logrus.Warnf("semaphore renew script err, key:%s, err:%s", sem.base.key, err.Error())
+		return err
+	}
+	if ret == 0 {
+		return ErrLockExpired
+	}
+
+	return nil
+}
+
+// acquire 执行一次获取，leave 为 true 时获取失败退出排队
+func (sem *Semaphore) acquire(leave bool) (bool, error) {
+	now := time.Now()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	expireAt := now.Add(time.Duration(sem.base.timeout)*time.Second).UnixNano() / int64(time.Millisecond)
+	leaveFlag := "0"
+	if leave {
+		leaveFlag = "1"
+	}
+
+	ret, err := redis.Int(sem.base.eval(semAcquireScript, sem.holdersKey, sem.waitersKey, sem.aliveKey, sem.ticketKey,
+		sem.base.value, nowMs, expireAt, sem.limit, nowMs+semWaiterTTL, leaveFlag))
+	if err != nil {
+		logrus.Warnf("semaphore acquire script err, key:%s, err:%s", sem.base.key, err.Error())
+		return false, err
+	}
+
+	return ret == 1, nil
+}
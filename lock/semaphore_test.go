@@ -0,0 +1,130 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// newTestSemaphore 基于连接池创建信号量
+func newTestSemaphore(t *testing.T, pool *redis.Pool, value string, limit int, timeout int) *Semaphore {
+	t.Helper()
+
+	sem, err := NewSemaphoreFromPool(pool, "k", value, limit, timeout)
+	if err != nil {
+		t.Fatalf("NewSemaphoreFromPool err: %v", err)
+	}
+	sem.EnableNotify()
+
+	return sem
+}
+
+func TestSemaphoreLimit(t *testing.T) {
+	_, pool := newTestPool(t)
+	a := newTestSemaphore(t, pool, "a", 2, 5)
+	b := newTestSemaphore(t, pool, "b", 2, 5)
+	c := newTestSemaphore(t, pool, "c", 2, 5)
+
+	if _, err := NewSemaphoreFromPool(pool, "k", "d", 0, 5); err == nil {
+		t.Error("NewSemaphoreFromPool with limit 0, want err")
+	}
+	for _, sem := range []*Semaphore{a, b} {
+		if ok, err := sem.TryAcquire(); !ok || err != nil {
+			t.Fatalf("TryAcquire = %v, %v, want true, nil", ok, err)
+		}
+	}
+	if ok, err := c.TryAcquire(); ok || err != nil {
+		t.Fatalf("c.TryAcquire over limit = %v, %v, want false, nil", ok, err)
+	}
+
+	// 同一持有者重复获取只占一个名额
+	if ok, _ := a.TryAcquire(); !ok {
+		t.Error("a.TryAcquire again failed")
+	}
+	if err := a.Release(); err != nil {
+		t.Fatalf("a.Release err: %v", err)
+	}
+	if err := a.Release(); err != ErrLockExpired {
+		t.Errorf("a.Release again = %v, want ErrLockExpired", err)
+	}
+	if ok, _ := c.TryAcquire(); !ok {
+		t.Error("c.TryAcquire after release failed")
+	}
+}
+
+func TestSemaphoreFIFO(t *testing.T) {
+	_, pool := newTestPool(t)
+	holder := newTestSemaphore(t, pool, "holder", 1, 5)
+	if ok, _ := holder.TryAcquire(); !ok {
+		t.Fatal("holder.TryAcquire failed")
+	}
+
+	// 1、两个等待者按先后顺序排队
+	order := make(chan string, 2)
+	for _, value := range []string{"w1", "w2"} {
+		sem := newTestSemaphore(t, pool, value, 1, 5)
+		go func(value string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			if err := sem.Acquire(ctx); err != nil {
+				t.Errorf("%s.Acquire err: %v", value, err)
+				order <- ""
+				return
+			}
+			order <- value
+			time.Sleep(50 * time.Millisecond)
+			sem.Release()
+		}(value)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// 2、排队期间新来的持有者不能插队
+	late := newTestSemaphore(t, pool, "late", 1, 5)
+	holder.Release()
+	if ok, _ := late.TryAcquire(); ok {
+		t.Error("late.TryAcquire jumped the queue")
+	}
+	if first, second := <-order, <-order; first != "w1" || second != "w2" {
+		t.Errorf("acquire order = %s, %s, want w1, w2", first, second)
+	}
+}
+
+func TestSemaphoreExpire(t *testing.T) {
+	mr, pool := newTestPool(t)
+	a := newTestSemaphore(t, pool, "a", 1, 1)
+	b := newTestSemaphore(t, pool, "b", 1, 1)
+
+	// 1、续期后在 timeout 之后仍然持有
+	if ok, _ := a.TryAcquire(); !ok {
+		t.Fatal("a.TryAcquire failed")
+	}
+	time.Sleep(600 * time.Millisecond)
+	if err := a.Renew(); err != nil {
+		t.Fatalf("a.Renew err: %v", err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if ok, _ := b.TryAcquire(); ok {
+		t.Fatal("b.TryAcquire succeeded while a renewed")
+	}
+
+	// 2、未续期的持有者过期后被清理
+	time.Sleep(500 * time.Millisecond)
+	if ok, _ := b.TryAcquire(); !ok {
+		t.Fatal("b.TryAcquire after a expired failed")
+	}
+	if err := a.Renew(); err != ErrLockExpired {
+		t.Errorf("a.Renew after expiry = %v, want ErrLockExpired", err)
+	}
+
+	// 3、Acquire 超时后退出排队，不占用排队位置
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("a.Acquire = %v, want DeadlineExceeded", err)
+	}
+	if n, _ := mr.ZMembers(semPrefix + "k:waiters"); len(n) != 0 {
+		t.Errorf("waiters after Acquire timeout = %v, want empty", n)
+	}
+}
@@ -0,0 +1,135 @@
+package lock
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minBackoff 等待锁的最小重试间隔
+	minBackoff = 10 * time.Millisecond
+	// maxBackoff 等待锁的最大重试间隔
+	maxBackoff = time.Second
+)
+
+// EnableNotify 开启锁释放通知，Lock 等待期间订阅锁释放消息，锁释放后立即唤醒重试而不必等到下次轮询
+func (lock *tryLock) EnableNotify() {
+	lock.confMu.Lock()
+	defer lock.confMu.Unlock()
+
+	lock.notify = true
+}
+
+// Lock 阻塞获取 redis 锁，直到获取成功或 ctx 结束；
+// 按指数退避加随机抖动重试，开启 EnableNotify 时锁释放会立即唤醒；ctx 结束时返回 ctx.Err()
+func (lock *tryLock) Lock(ctx context.Context) error {
+	return lock.wait(ctx, lock.acquire)
+}
+
+// wait 阻塞调用 try 直到获取成功或 ctx 结束，开启 EnableNotify 时订阅 key 的释放通知
+func (lock *tryLock) wait(ctx context.Context, try func() (bool, error)) error {
+	// 1、先订阅再抢锁，避免错过抢锁失败到开始等待之间的释放通知
+	lock.confMu.RLock()
+	notify := lock.notify
+	lock.confMu.RUnlock()
+
+	var wake <-chan struct{}
+	if notify {
+		ch, stop, err := lock.subscribe()
+		if err != nil {
+			logrus.Warnf("subscribe release err, key:%s, err:%s", lock.key, err.Error())
+		} else {
+			defer stop()
+			wake = ch
+		}
+	}
+
+	// 2、循环抢锁，redis 异常时同样退避重试
+	return waitLock(ctx, lockName(lock.key), wake, try)
+}
+
+// waitLock 循环调用 try 直到获取成功或 ctx 结束，wake 有消息时立即重试；name 为监控指标中的锁名称
+func waitLock(ctx context.Context, name string, wake <-chan struct{}, try func() (bool, error)) error {
+	m := getMetrics()
+	start := time.Now()
+	backoff := minBackoff
+	for {
+		m.Attempt(name)
+		ok, err := try()
+		if ok {
+			m.Acquired(name, time.Since(start))
+			return nil
+		}
+		m.Failed(name, failReason(err))
+
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			m.Failed(name, ReasonTimeout)
+			return ctx.Err()
+		case <-wake:
+			timer.Stop()
+			backoff = minBackoff
+			continue
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// jitter 在 [d/2, d) 区间内随机，避免多个等待方同时重试
+func jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// subscribe 单独建立连接订阅锁释放通知，返回通知 channel 和取消订阅方法；
+// 订阅连接不放回连接池，并且接收时不设置读超时
+func (lock *tryLock) subscribe() (<-chan struct{}, func(), error) {
+	conn, err := lock.pool.Dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(lock.key + releaseSuffix); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		for {
+			switch psc.ReceiveWithTimeout(0).(type) {
+			case redis.Message:
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			case error:
+				// 连接关闭后退出
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		psc.Unsubscribe()
+		conn.Close()
+	}
+
+	return ch, stop, nil
+}
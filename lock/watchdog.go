@@ -0,0 +1,127 @@
+package lock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// leaseSafetyRatio 看门狗租约安全余量占 timeout 的比例，覆盖 redis 与本机的时钟漂移和网络延迟
+const leaseSafetyRatio = 0.1
+
+// renewScript 比较持有者后再续期（持有者信息同时续期），避免给其他持有者的锁续期
+// 返回值：1 续期成功，0 锁被其他持有者持有，-1 锁已过期
+var renewScript = redis.NewScript(2, `
+local value = redis.call("GET", KEYS[1])
+if value == false then
+	return -1
+end
+if value ~= ARGV[1] then
+	return 0
+end
+redis.call("PEXPIRE", KEYS[2], ARGV[2])
+return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+`)
+
+// Renew 续期一次，将锁的过期时间重置为 timeout；
+// 锁被其他持有者持有时返回 ErrNotOwner，锁已过期时返回 ErrLockExpired
+func (lock *tryLock) Renew() error {
+	ttl := time.Duration(lock.timeout) * time.Second
+	sent := time.Now()
+	ret, err := redis.Int(lock.eval(renewScript, lock.key, lock.key+metaSuffix, lock.value, ttl.Milliseconds()))
+	getMetrics().Renewed(lockName(lock.key), err == nil && ret == 1)
+	if err != nil {
+		logrus.Warnf("renew script err, key:%s, err:%s", lock.key, err.Error())
+		return err
+	}
+
+	switch ret {
+	case -1:
+		return ErrLockExpired
+	case 0:
+		return ErrNotOwner
+	}
+	atomic.StoreInt64(&lock.leaseAt, sent.UnixNano())
+
+	return nil
+}
+
+// Watch 获取锁成功后开启看门狗，每隔 timeout/3 自动续期，直到 UnLock 或 parent 结束；
+// 返回的 ctx 在续期失败（锁已丢失）时被 cancel，持有者应监听 ctx.Done() 并中止临界区操作
+func (lock *tryLock) Watch(parent context.Context) context.Context {
+	lock.stopWatch()
+
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+
+	lock.watchMu.Lock()
+	lock.watchCancel = cancel
+	lock.watchDone = done
+	lock.watchMu.Unlock()
+
+	go lock.watch(ctx, cancel, done)
+
+	return ctx
+}
+
+// watch 看门狗协程；租约截止时间从发送加锁/续期命令的时间开始计算并预留安全余量，
+// 到期前续期没有成功时立即 cancel ctx（不等下次续期），保证持有者在锁过期之前感知锁丢失
+func (lock *tryLock) watch(ctx context.Context, cancel context.CancelFunc, done chan struct{}) {
+	defer close(done)
+	defer cancel()
+
+	ttl := time.Duration(lock.timeout) * time.Second
+	lease := ttl - time.Duration(float64(ttl)*leaseSafetyRatio)
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	// 1、租约从最近一次加锁或续期的时间开始计算，没有记录时从当前时间开始
+	start := time.Now()
+	if leaseAt := atomic.LoadInt64(&lock.leaseAt); leaseAt > 0 {
+		start = time.Unix(0, leaseAt)
+	}
+	expire := time.AfterFunc(time.Until(start.Add(lease)), func() {
+		logrus.Warnf("lock lease expired before renew, key:%s", lock.key)
+		cancel()
+	})
+	defer expire.Stop()
+
+	// 2、定时续期，续期成功后租约从发送续期命令的时间重新计算；redis 异常时持续重试直到租约到期
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := lock.Renew()
+		if err == nil {
+			expire.Reset(time.Until(time.Unix(0, atomic.LoadInt64(&lock.leaseAt)).Add(lease)))
+			continue
+		}
+		if err == ErrNotOwner || err == ErrLockExpired {
+			logrus.Warnf("lock lost, key:%s, err:%s", lock.key, err.Error())
+			return
+		}
+	}
+}
+
+// stopWatch 停止看门狗并等待协程退出，同时停止持有时长告警定时器（开启看门狗后不再需要告警）
+func (lock *tryLock) stopWatch() {
+	lock.watchMu.Lock()
+	cancel, done := lock.watchCancel, lock.watchDone
+	lock.watchCancel, lock.watchDone = nil, nil
+	if lock.holdTimer != nil {
+		lock.holdTimer.Stop()
+		lock.holdTimer = nil
+	}
+	lock.watchMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
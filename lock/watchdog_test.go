@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRenew(t *testing.T) {
+	mr, pool := newTestPool(t)
+	a := newTestLock(t, pool, "k", "a", 3)
+	b := newTestLock(t, pool, "k", "b", 3)
+
+	if err := a.Renew(); err != ErrLockExpired {
+		t.Errorf("Renew without lock = %v, want ErrLockExpired", err)
+	}
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("a.TryLock failed")
+	}
+	mr.FastForward(2 * time.Second)
+	if err := a.Renew(); err != nil {
+		t.Fatalf("Renew err: %v", err)
+	}
+	if ttl := mr.TTL(prefixKey + "k"); ttl != 3*time.Second {
+		t.Errorf("lock ttl after Renew = %s, want 3s", ttl)
+	}
+	if ttl := mr.TTL(prefixKey + "k" + metaSuffix); ttl != 3*time.Second {
+		t.Errorf("meta ttl after Renew = %s, want 3s", ttl)
+	}
+
+	// 其他持有者不能续期
+	if err := b.Renew(); err != ErrNotOwner {
+		t.Errorf("b.Renew = %v, want ErrNotOwner", err)
+	}
+}
+
+func TestWatchRenews(t *testing.T) {
+	mr, pool := newTestPool(t)
+	lock := newTestLock(t, pool, "k", "a", 1)
+
+	if ok, _ := lock.TryLock(); !ok {
+		t.Fatal("TryLock failed")
+	}
+	ctx := lock.Watch(context.Background())
+
+	// 每隔 timeout/3 续期，多个续期周期后 ctx 仍然有效，ttl 被重置
+	mr.FastForward(600 * time.Millisecond)
+	time.Sleep(1200 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("ctx cancelled while renewing: %v", ctx.Err())
+	}
+	if ttl := mr.TTL(prefixKey + "k"); ttl != time.Second {
+		t.Errorf("lock ttl = %s, want 1s", ttl)
+	}
+
+	if err := lock.UnLock(); err != nil {
+		t.Fatalf("UnLock err: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("ctx not cancelled after UnLock")
+	}
+}
+
+func TestWatchLockLost(t *testing.T) {
+	mr, pool := newTestPool(t)
+	lock := newTestLock(t, pool, "k", "a", 1)
+
+	if ok, _ := lock.TryLock(); !ok {
+		t.Fatal("TryLock failed")
+	}
+	ctx := lock.Watch(context.Background())
+
+	// 锁被其他持有者获取，下次续期时 cancel ctx
+	mr.Set(prefixKey+"k", "b")
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled after lock lost")
+	}
+}
+
+func TestWatchLeaseExpires(t *testing.T) {
+	mr, pool := newTestPool(t)
+	lock := newTestLock(t, pool, "k", "a", 1)
+
+	if ok, _ := lock.TryLock(); !ok {
+		t.Fatal("TryLock failed")
+	}
+	start := time.Now()
+	ctx := lock.Watch(context.Background())
+
+	// redis 不可用时续期一直失败，ctx 在租约扣除安全余量（timeout * 0.9）到期时被 cancel，早于锁过期
+	mr.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("ctx not cancelled after lease expired")
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("ctx cancelled after %s, want before the 1s ttl", d)
+	}
+}
+
+func TestWatchParentCancel(t *testing.T) {
+	_, pool := newTestPool(t)
+	lock := newTestLock(t, pool, "k", "a", 1)
+
+	if ok, _ := lock.TryLock(); !ok {
+		t.Fatal("TryLock failed")
+	}
+	parent, cancel := context.WithCancel(context.Background())
+	ctx := lock.Watch(parent)
+	cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled with parent")
+	}
+	lock.stopWatch()
+}
@@ -0,0 +1,391 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AccessCombined apache/nginx combined 格式，末尾追加请求 id 和耗时
+	AccessCombined = "combined"
+	// AccessJSON json 格式
+	AccessJSON = "json"
+
+	// defaultRequestIDHeader 默认的请求 id 头
+	defaultRequestIDHeader = "X-Request-Id"
+
+	// combinedTimeFormat combined 格式的时间格式
+	combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+	// maxRequestIDLen 客户端传入的请求 id 最大长度，超过时重新生成
+	maxRequestIDLen = 64
+)
+
+// requestIDKey 请求 id 在 context 中的 key
+type requestIDKey struct{}
+
+// AccessSampleRule 访问日志采样规则，路径前缀和状态码都命中时按 Rate 采样
+type AccessSampleRule struct {
+	// PathPrefix 路径前缀，为空表示全部路径
+	PathPrefix string
+	// MinStatus 最小状态码（含），为 0 表示不限制
+	MinStatus int
+	// MaxStatus 最大状态码（含），为 0 表示不限制
+	MaxStatus int
+	// Rate 采样比例，0 表示不记录，1 表示全部记录
+	Rate float64
+}
+
+// AccessConf 访问日志配置结构
+type AccessConf struct {
+	// Format 日志格式：combined/json，为空默认 combined
+	Format string
+	// TrustedProxies 可信代理的 ip 或网段（CIDR），只有直连方为可信代理时才使用 X-Forwarded-For
+	TrustedProxies []string
+	// RequestIDHeader 请求 id 头，为空默认 X-Request-Id；请求中没有或不合法（超过 64 个字符、包含字母数字和 . _ - 以外的字符）时自动生成并写回响应头
+	RequestIDHeader string
+	// Sampling 采样规则，按顺序取第一条命中的规则，都不命中时全部记录
+	Sampling []AccessSampleRule
+	// Writer 访问日志输出，为空时通过 logrus 以 info 级别输出到 NewLogger 配置的各输出
+	Writer io.Writer
+}
+
+// AccessLogger 访问日志对象
+type AccessLogger struct {
+	format          string
+	trustedProxies  []*net.IPNet
+	requestIDHeader string
+	sampling        []AccessSampleRule
+	writer          io.Writer
+}
+
+// AccessLoggerInterface 接口整理
+type AccessLoggerInterface interface {
+	// NewAccessLogger 获取访问日志对象
+	NewAccessLogger(conf AccessConf) (*AccessLogger, error)
+
+	// Handler net/http 中间件，记录每个请求的访问日志
+	Handler(next http.Handler) http.Handler
+}
+
+// accessRecord 单条访问日志
+type accessRecord struct {
+	Time      time.Time `json:"-"`
+	ClientIP  string    `json:"client_ip"`
+	User      string    `json:"user"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Referer   string    `json:"referer"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id"`
+	Latency   float64   `json:"latency"`
+}
+
+// responseWriter 记录响应状态码和字节数
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// NewAccessLogger 获取访问日志对象
+func NewAccessLogger(conf AccessConf) (*AccessLogger, error) {
+	a := &AccessLogger{
+		format:          conf.Format,
+		requestIDHeader: conf.RequestIDHeader,
+		sampling:        conf.Sampling,
+		writer:          conf.Writer,
+	}
+	if a.format == "" {
+		a.format = AccessCombined
+	}
+	if a.format != AccessCombined && a.format != AccessJSON {
+		return nil, errors.New("invalid access log format:" + a.format)
+	}
+	if a.requestIDHeader == "" {
+		a.requestIDHeader = defaultRequestIDHeader
+	}
+
+	// 可信代理统一转换成网段，单个 ip 视为 /32 或 /128
+	for _, proxy := range conf.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		a.trustedProxies = append(a.trustedProxies, ipNet)
+	}
+
+	return a, nil
+}
+
+// RequestID 获取 context 中的请求 id，由 AccessLogger.Handler 写入
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Handler net/http 中间件，记录每个请求的访问日志
+func (a *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// 1、获取或生成请求 id，写回响应头并放入 context；客户端传入的 id 不合法时重新生成，避免日志注入
+		requestID := r.Header.Get(a.requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(a.requestIDHeader, requestID)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID))
+
+		// 2、执行请求
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		// 3、按路径和状态码采样
+		if !a.sample(r.URL.Path, rw.status) {
+			return
+		}
+
+		user := "-"
+		if r.URL.User != nil && r.URL.User.Username() != "" {
+			user = r.URL.User.Username()
+		} else if name, _, ok := r.BasicAuth(); ok && name != "" {
+			user = name
+		}
+		a.write(&accessRecord{
+			Time:      start,
+			ClientIP:  a.clientIP(r),
+			User:      user,
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Status:    rw.status,
+			Bytes:     rw.bytes,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+			RequestID: requestID,
+			Latency:   time.Since(start).Seconds(),
+		})
+	})
+}
+
+// sample 按采样规则判断是否记录
+func (a *AccessLogger) sample(path string, status int) bool {
+	for _, rule := range a.sampling {
+		if rule.PathPrefix != "" && !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if rule.MinStatus > 0 && status < rule.MinStatus {
+			continue
+		}
+		if rule.MaxStatus > 0 && status > rule.MaxStatus {
+			continue
+		}
+		if rule.Rate >= 1 {
+			return true
+		}
+
+		return mrand.Float64() < rule.Rate
+	}
+
+	return true
+}
+
+// isTrustedProxy 判断 ip 是否为可信代理
+func (a *AccessLogger) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range a.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP 获取客户端 ip；直连方为可信代理时，从右往左取 X-Forwarded-For 中第一个非可信代理的 ip
+func (a *AccessLogger) clientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	if !a.isTrustedProxy(net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+
+	// 可能有多个 X-Forwarded-For 头，按出现顺序拼接后再从右往左取
+	xff := strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+	if xff == "" {
+		return remoteIP
+	}
+	ips := strings.Split(xff, ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip == "" {
+			continue
+		}
+		if !a.isTrustedProxy(net.ParseIP(ip)) || i == 0 {
+			return ip
+		}
+	}
+
+	return remoteIP
+}
+
+// write 输出访问日志
+func (a *AccessLogger) write(rec *accessRecord) {
+	// 1、json 格式
+	if a.format == AccessJSON {
+		if a.writer == nil {
+			logrus.WithFields(logrus.Fields{
+				"client_ip":  rec.ClientIP,
+				"user":       rec.User,
+				"method":     rec.Method,
+				"path":       rec.Path,
+				"proto":      rec.Proto,
+				"status":     rec.Status,
+				"bytes":      rec.Bytes,
+				"referer":    rec.Referer,
+				"user_agent": rec.UserAgent,
+				"request_id": rec.RequestID,
+				"latency":    rec.Latency,
+			}).Info("access")
+			return
+		}
+
+		line, err := json.Marshal(struct {
+			Time string `json:"time"`
+			*accessRecord
+		}{rec.Time.Format(timestampFormat), rec})
+		if err != nil {
+			logrus.Warnf("access log Marshal err, err:%s", err.Error())
+			return
+		}
+		a.writer.Write(append(line, '\n'))
+		return
+	}
+
+	// 2、combined 格式，客户端可控的字段转义后输出，避免伪造日志行或破坏字段引号
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" %s %.3f",
+		escapeField(rec.ClientIP), escapeField(rec.User), rec.Time.Format(combinedTimeFormat),
+		escapeField(rec.Method), escapeField(rec.Path), escapeField(rec.Proto), rec.Status, rec.Bytes,
+		escapeField(orDash(rec.Referer)), escapeField(orDash(rec.UserAgent)), rec.RequestID, rec.Latency)
+	if a.writer == nil {
+		logrus.Info(line)
+		return
+	}
+	a.writer.Write([]byte(line + "\n"))
+}
+
+// orDash 空字符串输出为 -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// escapeField 与 nginx 访问日志一致，把控制字符、双引号、反斜杠和非 ASCII 字节转义为 \xHH
+func escapeField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\x%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// validRequestID 请求 id 是否合法：非空、不超过 64 个字符，只包含字母、数字和 . _ -
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRequestID 生成请求 id
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// WriteHeader 记录状态码
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write 记录响应字节数
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+// Flush 支持流式响应
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持 websocket 等需要接管连接的场景
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+
+	return h.Hijack()
+}
@@ -0,0 +1,217 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultBufferSize 异步写缓冲区默认可容纳的日志条数
+	defaultBufferSize = 4096
+
+	// defaultFlushSize 缓冲区积攒到多少条日志时触发一次写入
+	defaultFlushSize = 512
+
+	// defaultFlushInterval 定时刷盘默认时间间隔，单位：ms
+	defaultFlushInterval = 1000
+)
+
+// AsyncConf 异步写配置结构
+type AsyncConf struct {
+	// BufferSize 环形缓冲区容量，单位：条
+	BufferSize int
+	// FlushSize 缓冲区日志条数达到该值时立即刷盘
+	FlushSize int
+	// FlushInterval 定时刷盘时间间隔，单位：ms
+	FlushInterval int
+	// DropWhenFull 缓冲区满时是否丢弃日志；false 表示阻塞等待，true 表示丢弃并计数
+	DropWhenFull bool
+}
+
+// AsyncWriter 异步日志写对象，位于 logrus 与实际输出之间，减少热点路径上的写盘耗时
+type AsyncWriter struct {
+	out  io.Writer
+	conf AsyncConf
+
+	// mu 保护环形缓冲区
+	mu      sync.Mutex
+	notFull *sync.Cond
+	ring    [][]byte
+	head    int
+	count   int
+	closed  bool
+
+	// writeMu 保证批量写入 out 的顺序与写入缓冲区的顺序一致
+	writeMu sync.Mutex
+
+	dropped uint64
+	kick    chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// AsyncWriterInterface 接口整理
+type AsyncWriterInterface interface {
+	// NewAsyncWriter 获取异步写对象
+	NewAsyncWriter(out io.Writer, conf AsyncConf) *AsyncWriter
+
+	// Write 写入缓冲区，由后台协程批量写到 out
+	Write(p []byte) (int, error)
+	// Flush 将缓冲区内的日志全部写到 out
+	Flush() error
+	// Close 刷盘并停止后台协程
+	Close() error
+	// Dropped 获取缓冲区满时被丢弃的日志条数
+	Dropped() uint64
+}
+
+// NewAsyncWriter 获取异步写对象
+func NewAsyncWriter(out io.Writer, conf AsyncConf) *AsyncWriter {
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = defaultBufferSize
+	}
+	if conf.FlushSize <= 0 || conf.FlushSize > conf.BufferSize {
+		conf.FlushSize = defaultFlushSize
+		if conf.FlushSize > conf.BufferSize {
+			conf.FlushSize = conf.BufferSize
+		}
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+
+	w := &AsyncWriter{
+		out:  out,
+		conf: conf,
+		ring: make([][]byte, conf.BufferSize),
+		kick: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w
+}
+
+// run 后台刷盘协程，定时或者缓冲区条数达到 FlushSize 时触发
+func (w *AsyncWriter) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(w.conf.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.kick:
+			w.Flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Write 写入缓冲区；logrus 会复用 p，这里需要拷贝一份
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	for !w.closed && w.count == len(w.ring) {
+		if w.conf.DropWhenFull {
+			w.mu.Unlock()
+			atomic.AddUint64(&w.dropped, 1)
+			return len(p), nil
+		}
+		w.notFull.Wait()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return w.writeDirect(p)
+	}
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	w.ring[(w.head+w.count)%len(w.ring)] = buf
+	w.count++
+	needFlush := w.count >= w.conf.FlushSize
+	w.mu.Unlock()
+
+	if needFlush {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// writeDirect 关闭后直接同步写，避免进程退出阶段的日志丢失
+func (w *AsyncWriter) writeDirect(p []byte) (int, error) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	return w.out.Write(p)
+}
+
+// Flush 将缓冲区内的日志全部写到 out
+func (w *AsyncWriter) Flush() error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	return w.flushLocked()
+}
+
+// flushLocked 刷盘逻辑，调用方需持有 writeMu
+func (w *AsyncWriter) flushLocked() error {
+	// 1、取出缓冲区内的全部日志，并唤醒阻塞的写入方
+	w.mu.Lock()
+	if w.count == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	var buf bytes.Buffer
+	for i := 0; i < w.count; i++ {
+		idx := (w.head + i) % len(w.ring)
+		buf.Write(w.ring[idx])
+		w.ring[idx] = nil
+	}
+	w.head, w.count = 0, 0
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+
+	// 2、合并成一次写入，减少系统调用
+	_, err := w.out.Write(buf.Bytes())
+	return err
+}
+
+// Close 刷盘并停止后台协程，重复调用安全
+func (w *AsyncWriter) Close() error {
+	// 持有 writeMu 完成最后一次刷盘，保证关闭后的同步写排在缓冲区日志之后
+	w.writeMu.Lock()
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		w.writeMu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+	err := w.flushLocked()
+	w.writeMu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	return err
+}
+
+// Dropped 获取缓冲区满时被丢弃的日志条数
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
@@ -1,9 +1,8 @@
 package log
 
 import (
-	"time"
+	"io/ioutil"
 
-	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,6 +15,9 @@ var (
 
 	// defaultRotationCount 设置日志保留个数（保留3天）
 	rotationCount = 72
+
+	// outputHook 日志分发 hook，全局只注册一次，重复初始化时替换其中的输出
+	outputHook *sinkHook
 )
 
 // ConfInfo 日志配置结构
@@ -23,6 +25,20 @@ type ConfInfo struct {
 	LogPath       string
 	RotationTime  int
 	RotationCount int
+
+	// Async 是否开启异步写，开启后需在进程退出前调用 Close 保证日志落盘
+	Async bool
+	// AsyncConf 异步写配置，Async 为 true 时生效
+	AsyncConf AsyncConf
+
+	// Sinks 多路输出配置，为空时只输出到 LogPath 对应的切割文件
+	Sinks []SinkConf
+
+	// Sampling 日志采样和重复抑制配置，默认不开启
+	Sampling SamplingConf
+
+	// Redact 日志脱敏配置，默认不开启
+	Redact RedactConf
 }
 
 // NewLogger 日志打印设置
@@ -37,15 +53,90 @@ func NewLogger(c ConfInfo) {
 		rotationCount = c.RotationCount
 	}
 
-	writer, _ := rotatelogs.New(
-		logPath+".%Y%m%d%H",
-		rotatelogs.WithLinkName(logPath),
-		rotatelogs.WithRotationCount(uint(rotationCount)),
-		rotatelogs.WithRotationTime(time.Duration(rotationTime)*time.Hour),
-	)
-	logrus.SetOutput(writer)
+	// 1、未配置多路输出时默认输出到切割文件
+	sinkConfs := c.Sinks
+	if len(sinkConfs) == 0 {
+		sinkConfs = []SinkConf{{
+			Type:          SinkFile,
+			LogPath:       logPath,
+			RotationTime:  rotationTime,
+			RotationCount: rotationCount,
+			Async:         c.Async,
+			AsyncConf:     c.AsyncConf,
+		}}
+	}
+
+	// 2、初始化各输出，logger 级别取各输出中最低的级别
+	var sinks []*sink
+	var confErrs []error
+	level := logrus.PanicLevel
+	for _, sc := range sinkConfs {
+		s, err := newSink(sc)
+		if err != nil {
+			confErrs = append(confErrs, err)
+			continue
+		}
+		sinks = append(sinks, s)
+		if s.level > level {
+			level = s.level
+		}
+	}
+	if len(sinks) == 0 {
+		level = logrus.InfoLevel
+	}
+
+	// 3、初始化脱敏规则，规则有误时不脱敏
+	redactor, err := NewRedactor(c.Redact)
+	if err != nil {
+		confErrs = append(confErrs, err)
+	}
+
+	// 4、logrus 自身不再输出，由 hook 分发到各输出
+	if outputHook == nil {
+		outputHook = &sinkHook{}
+		logrus.AddHook(outputHook)
+	}
+	outputHook.setSampler(nil)
+	for _, s := range outputHook.setSinks(sinks) {
+		s.close()
+	}
+	outputHook.setSampler(newSampler(c.Sampling, outputHook.emit))
+	outputHook.setRedactor(redactor)
+	logrus.SetOutput(ioutil.Discard)
+	logrus.SetLevel(level)
 	logrus.SetReportCaller(true)
-	logrus.SetFormatter(&logrus.TextFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	logrus.SetFormatter(&discardFormatter{})
+
+	for _, err := range confErrs {
+		logrus.Warnf("NewLogger conf err, err:%s", err.Error())
+	}
+}
+
+// sharedRedactor NewLogger 配置的脱敏对象，未调用 NewLogger 或未配置脱敏规则时返回 nil
+func sharedRedactor() *Redactor {
+	if outputHook == nil {
+		return nil
+	}
+	outputHook.mu.RLock()
+	defer outputHook.mu.RUnlock()
+
+	return outputHook.redactor
+}
+
+// Flush 将异步写缓冲区内的日志全部落盘，未开启异步写时直接返回
+func Flush() error {
+	if outputHook == nil {
+		return nil
+	}
+
+	return outputHook.flush()
+}
+
+// Close 关闭日志输出，进程退出前调用，保证缓冲区内的日志全部落盘
+func Close() error {
+	if outputHook == nil {
+		return nil
+	}
+
+	return outputHook.close()
 }
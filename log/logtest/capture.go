@@ -0,0 +1,261 @@
+// Package logtest 单元测试中捕获日志的工具，将 logger 输出的日志保存在内存中供断言使用，
+// 也可以同时将日志转发到 testing.T.Log，只在测试失败或 -v 时打印
+package logtest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TB testing.T/testing.B 中用到的方法，避免非测试代码引入 testing 包
+type TB interface {
+	Helper()
+	Log(args ...interface{})
+	Cleanup(f func())
+}
+
+// Query 日志查询条件，零值字段表示不限制
+type Query struct {
+	// Levels 日志级别，满足任意一个即可
+	Levels []logrus.Level
+	// Message 日志内容包含的子串
+	Message string
+	// Fields 日志字段，需全部相等
+	Fields logrus.Fields
+}
+
+// Capture 日志捕获对象，实现 logrus.Hook
+type Capture struct {
+	logger    *logrus.Logger
+	formatter logrus.Formatter
+	oldLevel  logrus.Level
+	oldOut    io.Writer
+
+	mu      sync.Mutex
+	entries []*logrus.Entry
+	t       TB
+	closed  bool
+}
+
+// CaptureInterface 接口整理
+type CaptureInterface interface {
+	// NewCapture 获取日志捕获对象，开始捕获 logger 的日志
+	NewCapture(logger *logrus.Logger) *Capture
+	// NewTestCapture 获取日志捕获对象，同时转发到 t.Log，测试结束时自动停止
+	NewTestCapture(t TB, logger *logrus.Logger) *Capture
+
+	// Entries 获取全部日志
+	Entries() []*logrus.Entry
+	// Find 按条件查询日志
+	Find(q Query) []*logrus.Entry
+	// ByLevel 按级别查询日志
+	ByLevel(levels ...logrus.Level) []*logrus.Entry
+	// Contains 按内容子串查询日志
+	Contains(substr string) []*logrus.Entry
+	// WithField 按字段查询日志
+	WithField(key string, value interface{}) []*logrus.Entry
+	// Last 获取最后一条日志
+	Last() *logrus.Entry
+	// Len 获取日志条数
+	Len() int
+	// Reset 清空已捕获的日志
+	Reset()
+	// Close 停止捕获并恢复 logger 级别和输出
+	Close()
+}
+
+// NewCapture 获取日志捕获对象，logger 为空时捕获 logrus 全局 logger；
+// 捕获期间 logger 级别调整为 trace，保证所有级别的日志都能被捕获，Close 时恢复
+func NewCapture(logger *logrus.Logger) *Capture {
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	c := &Capture{
+		logger: logger,
+		formatter: &logrus.TextFormatter{
+			DisableColors:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		},
+		oldLevel: logger.GetLevel(),
+	}
+	logger.SetLevel(logrus.TraceLevel)
+	logger.AddHook(c)
+
+	return c
+}
+
+// NewTestCapture 获取日志捕获对象，同时将日志转发到 t.Log，测试结束时自动停止捕获；
+// 捕获期间 logger 自身的输出被丢弃，日志只出现在测试输出中
+func NewTestCapture(t TB, logger *logrus.Logger) *Capture {
+	t.Helper()
+
+	c := NewCapture(logger)
+	c.mu.Lock()
+	c.t = t
+	c.oldOut = c.logger.Out
+	c.mu.Unlock()
+	c.logger.SetOutput(ioutil.Discard)
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+// Levels 捕获全部级别
+func (c *Capture) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 保存日志，logrus 可能复用 entry，这里保存一份拷贝
+func (c *Capture) Fire(entry *logrus.Entry) error {
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	e := &logrus.Entry{
+		Logger:  entry.Logger,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Caller:  entry.Caller,
+		Message: entry.Message,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.entries = append(c.entries, e)
+	if c.t != nil {
+		if b, err := c.formatter.Format(e); err == nil {
+			c.t.Log(strings.TrimRight(string(b), "\n"))
+		}
+	}
+
+	return nil
+}
+
+// Entries 获取全部日志
+func (c *Capture) Entries() []*logrus.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]*logrus.Entry, len(c.entries))
+	copy(entries, c.entries)
+
+	return entries
+}
+
+// Find 按条件查询日志
+func (c *Capture) Find(q Query) []*logrus.Entry {
+	var ret []*logrus.Entry
+	for _, entry := range c.Entries() {
+		if match(entry, q) {
+			ret = append(ret, entry)
+		}
+	}
+
+	return ret
+}
+
+// ByLevel 按级别查询日志
+func (c *Capture) ByLevel(levels ...logrus.Level) []*logrus.Entry {
+	return c.Find(Query{Levels: levels})
+}
+
+// Contains 按内容子串查询日志
+func (c *Capture) Contains(substr string) []*logrus.Entry {
+	return c.Find(Query{Message: substr})
+}
+
+// WithField 按字段查询日志，字段值使用 fmt 格式化后比较，error 等类型也可直接比较
+func (c *Capture) WithField(key string, value interface{}) []*logrus.Entry {
+	return c.Find(Query{Fields: logrus.Fields{key: value}})
+}
+
+// Last 获取最后一条日志，没有日志时返回 nil
+func (c *Capture) Last() *logrus.Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) == 0 {
+		return nil
+	}
+
+	return c.entries[len(c.entries)-1]
+}
+
+// Len 获取日志条数
+func (c *Capture) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// Reset 清空已捕获的日志
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// Close 停止捕获，从 logger 中移除 hook 并恢复 logger 级别和输出，重复调用安全
+func (c *Capture) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	hooks := make(logrus.LevelHooks)
+	for level, levelHooks := range c.logger.ReplaceHooks(make(logrus.LevelHooks)) {
+		for _, hook := range levelHooks {
+			if hook != c {
+				hooks[level] = append(hooks[level], hook)
+			}
+		}
+	}
+	c.logger.ReplaceHooks(hooks)
+	c.logger.SetLevel(c.oldLevel)
+	if c.oldOut != nil {
+		c.logger.SetOutput(c.oldOut)
+	}
+}
+
+// match 判断日志是否满足查询条件
+func match(entry *logrus.Entry, q Query) bool {
+	if len(q.Levels) > 0 {
+		found := false
+		for _, level := range q.Levels {
+			if entry.Level == level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Message != "" && !strings.Contains(entry.Message, q.Message) {
+		return false
+	}
+	for key, value := range q.Fields {
+		v, ok := entry.Data[key]
+		if !ok || fmt.Sprint(v) != fmt.Sprint(value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,182 @@
+package logtest
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeTB 记录 Log 和 Cleanup 调用的 TB
+type fakeTB struct {
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	for _, arg := range args {
+		f.logs = append(f.logs, arg.(string))
+	}
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) runCleanups() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func newLogger() (*logrus.Logger, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetLevel(logrus.WarnLevel)
+
+	return logger, out
+}
+
+func TestCaptureQuery(t *testing.T) {
+	logger, _ := newLogger()
+	c := NewCapture(logger)
+	defer c.Close()
+
+	logger.Debug("debug message")
+	logger.WithField("user", "alice").Info("login ok")
+	logger.WithFields(logrus.Fields{"user": "bob", "err": errors.New("bad passwd")}).Warn("login failed")
+	logger.Error("db down")
+
+	if c.Len() != 4 {
+		t.Fatalf("Len = %d, want 4", c.Len())
+	}
+	if got := c.ByLevel(logrus.WarnLevel, logrus.ErrorLevel); len(got) != 2 {
+		t.Errorf("ByLevel(warn, error) = %d entries, want 2", len(got))
+	}
+	if got := c.Contains("login"); len(got) != 2 {
+		t.Errorf("Contains(login) = %d entries, want 2", len(got))
+	}
+	if got := c.WithField("user", "bob"); len(got) != 1 || got[0].Message != "login failed" {
+		t.Errorf("WithField(user, bob) = %v, want the login failed entry", got)
+	}
+	if got := c.WithField("err", "bad passwd"); len(got) != 1 {
+		t.Errorf("WithField(err, bad passwd) = %d entries, want 1", len(got))
+	}
+	got := c.Find(Query{Levels: []logrus.Level{logrus.InfoLevel}, Message: "login", Fields: logrus.Fields{"user": "alice"}})
+	if len(got) != 1 {
+		t.Errorf("Find = %d entries, want 1", len(got))
+	}
+	if got := c.Find(Query{Levels: []logrus.Level{logrus.InfoLevel}, Fields: logrus.Fields{"user": "bob"}}); len(got) != 0 {
+		t.Errorf("Find with unmatched field = %d entries, want 0", len(got))
+	}
+	if last := c.Last(); last == nil || last.Message != "db down" {
+		t.Errorf("Last = %v, want db down", last)
+	}
+
+	c.Reset()
+	if c.Len() != 0 || c.Last() != nil {
+		t.Errorf("after Reset Len = %d, Last = %v, want empty", c.Len(), c.Last())
+	}
+}
+
+func TestCaptureCopiesEntry(t *testing.T) {
+	logger, _ := newLogger()
+	c := NewCapture(logger)
+	defer c.Close()
+
+	fields := logrus.Fields{"k": "v1"}
+	logger.WithFields(fields).Warn("first")
+	fields["k"] = "v2"
+	logger.WithFields(fields).Warn("second")
+
+	entries := c.Entries()
+	if len(entries) != 2 || entries[0].Data["k"] != "v1" {
+		t.Errorf("first entry data = %v, want k=v1", entries[0].Data)
+	}
+	entries[0] = nil
+	if c.Entries()[0] == nil {
+		t.Error("Entries returned the internal slice")
+	}
+}
+
+func TestCaptureClose(t *testing.T) {
+	logger, out := newLogger()
+	other := NewCapture(logger)
+	defer other.Close()
+	c := NewCapture(logger)
+
+	c.Close()
+	c.Close()
+	if logger.GetLevel() != logrus.TraceLevel {
+		t.Errorf("level after Close = %s, want trace set by the other capture", logger.GetLevel())
+	}
+	other.Close()
+	if logger.GetLevel() != logrus.WarnLevel {
+		t.Errorf("level after all Close = %s, want warn", logger.GetLevel())
+	}
+
+	logger.Warn("after close")
+	if c.Len() != 0 || other.Len() != 0 {
+		t.Errorf("captured after Close, Len = %d/%d", c.Len(), other.Len())
+	}
+	for _, hooks := range logger.Hooks {
+		if len(hooks) != 0 {
+			t.Fatalf("hooks left after Close: %v", logger.Hooks)
+		}
+	}
+	if !strings.Contains(out.String(), "after close") {
+		t.Errorf("logger output = %q, want the entry written after Close", out.String())
+	}
+}
+
+func TestCaptureKeepsOtherHooks(t *testing.T) {
+	logger, _ := newLogger()
+	keep := NewCapture(logrus.New())
+	defer keep.Close()
+	logger.AddHook(keep)
+
+	c := NewCapture(logger)
+	c.Close()
+
+	logger.Warn("still hooked")
+	if keep.Len() != 1 {
+		t.Errorf("other hook got %d entries, want 1", keep.Len())
+	}
+}
+
+func TestTestCapture(t *testing.T) {
+	logger, out := newLogger()
+	tb := &fakeTB{}
+	c := NewTestCapture(tb, logger)
+
+	logger.WithField("id", 1).Info("hello")
+	if c.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", c.Len())
+	}
+	if len(tb.logs) != 1 || !strings.Contains(tb.logs[0], "msg=hello") || !strings.Contains(tb.logs[0], "id=1") {
+		t.Errorf("t.Log got %q, want the formatted entry", tb.logs)
+	}
+	if out.Len() != 0 {
+		t.Errorf("logger output during capture = %q, want discarded", out.String())
+	}
+	if len(tb.cleanups) != 1 {
+		t.Fatalf("Cleanup registered %d times, want 1", len(tb.cleanups))
+	}
+
+	tb.runCleanups()
+	logger.Warn("restored")
+	if logger.GetLevel() != logrus.WarnLevel {
+		t.Errorf("level after cleanup = %s, want warn", logger.GetLevel())
+	}
+	if !strings.Contains(out.String(), "restored") {
+		t.Errorf("logger output after cleanup = %q, want restored", out.String())
+	}
+	if len(tb.logs) != 1 {
+		t.Errorf("t.Log called after cleanup, logs = %q", tb.logs)
+	}
+}
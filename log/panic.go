@@ -0,0 +1,182 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RecoverConf panic 捕获配置结构
+type RecoverConf struct {
+	// RePanic 记录日志后是否继续 panic；为 false 时协程包装直接结束协程，HTTP 中间件返回 500
+	RePanic bool
+	// DumpDir 崩溃现场文件目录，为空表示不写文件；文件中包含 panic 信息和全部协程的堆栈
+	DumpDir string
+	// Fields 额外记录的上下文字段
+	Fields logrus.Fields
+}
+
+// Recover panic 捕获对象，可用于协程包装和 HTTP 中间件
+type Recover struct {
+	conf RecoverConf
+}
+
+// RecoverInterface 接口整理
+type RecoverInterface interface {
+	// NewRecover 获取 panic 捕获对象
+	NewRecover(conf RecoverConf) *Recover
+
+	// Go 启动协程，协程内的 panic 会被记录
+	Go(fn func(), fields logrus.Fields)
+	// Handler net/http 中间件，请求处理中的 panic 会被记录
+	Handler(next http.Handler) http.Handler
+}
+
+// NewRecover 获取 panic 捕获对象
+func NewRecover(conf RecoverConf) *Recover {
+	return &Recover{conf: conf}
+}
+
+// Go 启动协程，协程内的 panic 会被记录，fields 为本次调用的上下文字段
+func (r *Recover) Go(fn func(), fields logrus.Fields) {
+	go func() {
+		defer r.capture(fields)
+		fn()
+	}()
+}
+
+// Handler net/http 中间件，请求处理中的 panic 会被记录，未配置 RePanic 时返回 500
+func (r *Recover) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// http.ErrAbortHandler 是主动中断请求，不需要记录
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			fields := logrus.Fields{
+				"method": req.Method,
+				"path":   req.URL.RequestURI(),
+				"remote": req.RemoteAddr,
+			}
+			if requestID := RequestID(req.Context()); requestID != "" {
+				fields["request_id"] = requestID
+			}
+			r.report(v, debug.Stack(), fields)
+
+			if r.conf.RePanic {
+				panic(v)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// capture 协程包装中使用，需直接被 defer 调用才能捕获 panic
+func (r *Recover) capture(fields logrus.Fields) {
+	v := recover()
+	if v == nil {
+		return
+	}
+
+	r.report(v, debug.Stack(), fields)
+	if r.conf.RePanic {
+		panic(v)
+	}
+}
+
+// report 记录 panic 信息：日志、刷盘、写崩溃现场文件
+func (r *Recover) report(v interface{}, stack []byte, fields logrus.Fields) {
+	// 1、记录 panic 值、协程 id 和堆栈
+	entryFields := logrus.Fields{}
+	for k, val := range r.conf.Fields {
+		entryFields[k] = val
+	}
+	for k, val := range fields {
+		entryFields[k] = val
+	}
+	entryFields["goroutine"] = goroutineID(stack)
+	entryFields["stack"] = string(stack)
+	// panic 日志不参与采样和去重，避免 panic 循环时后续的堆栈被丢弃
+	withoutSampling().WithFields(entryFields).Errorf("panic recovered, panic:%v", v)
+
+	// 2、写崩溃现场文件
+	if r.conf.DumpDir != "" {
+		if path, err := writeDump(r.conf.DumpDir, v, stack, entryFields); err != nil {
+			logrus.Warnf("write crash dump err, err:%s", err.Error())
+		} else {
+			logrus.Errorf("crash dump written, path:%s", path)
+		}
+	}
+
+	// 3、异步写缓冲区落盘，避免进程随后退出时丢失日志
+	Flush()
+}
+
+// goroutineID 从堆栈第一行 "goroutine 18 [running]:" 中解析协程 id
+func goroutineID(stack []byte) int64 {
+	line := stack
+	if i := bytes.IndexByte(stack, '\n'); i >= 0 {
+		line = stack[:i]
+	}
+	fields := bytes.Fields(line)
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+
+	return id
+}
+
+// writeDump 写崩溃现场文件，包含 panic 信息、上下文字段和全部协程的堆栈
+func writeDump(dir string, v interface{}, stack []byte, fields logrus.Fields) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// 获取全部协程堆栈，缓冲区不够时翻倍
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var content bytes.Buffer
+	now := time.Now()
+	fmt.Fprintf(&content, "time: %s\n", now.Format(timestampFormat))
+	fmt.Fprintf(&content, "pid: %d\n", os.Getpid())
+	fmt.Fprintf(&content, "panic: %v\n", v)
+	for k, val := range fields {
+		if k == "stack" {
+			continue
+		}
+		fmt.Fprintf(&content, "%s: %v\n", k, val)
+	}
+	fmt.Fprintf(&content, "\n%s\n\n== all goroutines\n%s", stack, buf)
+
+	path := filepath.Join(dir, fmt.Sprintf("crash.%d.%s.log", os.Getpid(), now.Format("20060102150405.000")))
+	if err := ioutil.WriteFile(path, content.Bytes(), 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,194 @@
+package log
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMask 脱敏后的默认替换内容
+const defaultMask = "******"
+
+var (
+	// builtinFieldWords 内置敏感字段名关键字，字段名（小写）包含其中任意一个即整体脱敏
+	builtinFieldWords = []string{"password", "passwd", "pwd", "token", "secret", "authorization", "cookie"}
+
+	// secretKvReg 内置规则：日志内容中 password=xxx、token:xxx 形式的敏感值
+	secretKvReg = regexp.MustCompile(`(?i)((?:password|passwd|pwd|token|secret|api_?key|auth)\s*[=:]\s*)[^\s,;&"']+`)
+
+	// emailReg 内置规则：邮箱
+	emailReg = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// digitsReg 内置规则：连续数字，再按长度区分手机号和银行卡号
+	digitsReg = regexp.MustCompile(`[0-9]+`)
+)
+
+// RedactConf 日志脱敏配置结构
+type RedactConf struct {
+	// Builtin 是否开启内置规则：密码/token 等敏感字段、邮箱、手机号、银行卡号；银行卡号按 Luhn 校验识别，约 1/10 的 13-19 位长数字 id 也会被脱敏
+	Builtin bool
+	// Fields 需要整体脱敏的字段名，不区分大小写
+	Fields []string
+	// Patterns 自定义正则，日志内容和字符串字段中匹配的部分会被替换
+	Patterns []string
+	// Mask 替换内容，为空默认 ******
+	Mask string
+}
+
+// Redactor 日志脱敏对象，对日志内容和字段在格式化之前做脱敏处理
+type Redactor struct {
+	builtin  bool
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+	mask     string
+}
+
+// RedactorInterface 接口整理
+type RedactorInterface interface {
+	// NewRedactor 获取脱敏对象
+	NewRedactor(conf RedactConf) (*Redactor, error)
+
+	// String 字符串脱敏
+	String(s string) string
+	// Fields 日志字段脱敏，返回新的字段
+	Fields(fields logrus.Fields) logrus.Fields
+}
+
+// NewRedactor 获取脱敏对象，未配置任何规则时返回 nil
+func NewRedactor(conf RedactConf) (*Redactor, error) {
+	if !conf.Builtin && len(conf.Fields) == 0 && len(conf.Patterns) == 0 {
+		return nil, nil
+	}
+
+	r := &Redactor{
+		builtin: conf.Builtin,
+		fields:  make(map[string]bool, len(conf.Fields)),
+		mask:    conf.Mask,
+	}
+	if r.mask == "" {
+		r.mask = defaultMask
+	}
+	for _, field := range conf.Fields {
+		r.fields[strings.ToLower(field)] = true
+	}
+	for _, pattern := range conf.Patterns {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, reg)
+	}
+
+	return r, nil
+}
+
+// isSensitiveField 判断字段是否需要整体脱敏
+func (r *Redactor) isSensitiveField(key string) bool {
+	key = strings.ToLower(key)
+	if r.fields[key] {
+		return true
+	}
+	if !r.builtin {
+		return false
+	}
+	for _, word := range builtinFieldWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String 字符串脱敏
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+
+	if r.builtin {
+		s = secretKvReg.ReplaceAllString(s, "${1}"+r.mask)
+		s = emailReg.ReplaceAllString(s, r.mask)
+		s = digitsReg.ReplaceAllStringFunc(s, func(num string) string {
+			if isPhone(num) || isCard(num) {
+				return r.mask
+			}
+			return num
+		})
+	}
+	for _, reg := range r.patterns {
+		s = reg.ReplaceAllString(s, r.mask)
+	}
+
+	return s
+}
+
+// Fields 日志字段脱敏，返回新的字段，不修改入参
+func (r *Redactor) Fields(fields logrus.Fields) logrus.Fields {
+	if r == nil || len(fields) == 0 {
+		return fields
+	}
+
+	ret := make(logrus.Fields, len(fields))
+	for key, value := range fields {
+		if r.isSensitiveField(key) {
+			ret[key] = r.mask
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			ret[key] = r.String(v)
+		case error:
+			if s := r.String(v.Error()); s != v.Error() {
+				ret[key] = s
+			} else {
+				ret[key] = v
+			}
+		default:
+			ret[key] = value
+		}
+	}
+
+	return ret
+}
+
+// entry 日志对象脱敏，直接修改日志内容，之后的输出和 hook 拿到的都是脱敏后的日志
+func (r *Redactor) entry(entry *logrus.Entry) {
+	if r == nil {
+		return
+	}
+
+	entry.Message = r.String(entry.Message)
+	entry.Data = r.Fields(entry.Data)
+}
+
+// isPhone 判断是否为手机号
+func isPhone(num string) bool {
+	return len(num) == 11 && num[0] == '1' && num[1] >= '3'
+}
+
+// isCard 判断是否为银行卡号：13-19 位且通过 Luhn 校验；Luhn 只能降低误伤，随机长数字（如雪花 id）约有 1/10 能通过校验，同样会被脱敏
+func isCard(num string) bool {
+	if len(num) < 13 || len(num) > 19 {
+		return false
+	}
+
+	// Luhn 校验，银行卡号的最后一位为校验位
+	sum := 0
+	double := false
+	for i := len(num) - 1; i >= 0; i-- {
+		d := int(num[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,414 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultHookStream 默认的 redis stream key
+	defaultHookStream = "log_stream"
+
+	// defaultHookMaxLen stream 默认保留的日志条数（近似值）
+	defaultHookMaxLen = 100000
+
+	// defaultHookBatchSize 默认每批发送的日志条数
+	defaultHookBatchSize = 100
+
+	// defaultHookQueueSize 内存队列默认容量，队列满时丢弃并计数
+	defaultHookQueueSize = 10000
+
+	// defaultMaxSpoolSize 本地落盘文件默认大小上限，单位：字节（100M）
+	defaultMaxSpoolSize = 100 << 20
+
+	// hookRedisTimeout redis 连接、读、写超时时间，单位：ms
+	hookRedisTimeout = 1000
+)
+
+// RedisHookConf 日志上报 redis stream 配置结构
+type RedisHookConf struct {
+	// Host/Port/Passwd redis 连接信息
+	Host   string
+	Port   string
+	Passwd string
+
+	// Stream redis stream key，为空默认 log_stream
+	Stream string
+	// MaxLen stream 保留的日志条数（近似值），为 0 默认 100000
+	MaxLen int
+	// Level 最低上报级别，为空默认 warn
+	Level string
+
+	// BatchSize 每批发送的日志条数，为 0 默认 100
+	BatchSize int
+	// FlushInterval 定时发送时间间隔，单位：ms，为 0 默认 1000
+	FlushInterval int
+	// QueueSize 内存队列容量，为 0 默认 10000
+	QueueSize int
+
+	// SpoolPath redis 不可用时的本地落盘文件，恢复后会先重放；为空表示不落盘直接丢弃
+	SpoolPath string
+	// MaxSpoolSize 本地落盘文件大小上限，单位：字节，为 0 默认 100M，超过后丢弃
+	MaxSpoolSize int64
+}
+
+// RedisHook 将 warn/error 日志批量上报到 redis stream 的 logrus hook，
+// 通过 logrus.AddHook 注册；上报前使用 NewLogger 配置的脱敏规则自行脱敏，与 hook 注册顺序无关；
+// 注意 logrus 全局级别由 NewLogger 的各输出决定，低于该级别的日志不会触发 hook
+type RedisHook struct {
+	conf     RedisHookConf
+	levels   []logrus.Level
+	hostname string
+
+	// conn 只在后台协程中使用，redis 不可用时置空，下次发送前重连；
+	// 直接使用 redigo 连接而不是 store 包，发送失败不会打印日志，避免日志再次触发 hook 循环上报
+	conn    redis.Conn
+	dropped uint64
+
+	queue chan map[string]string
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// RedisHookInterface 接口整理
+type RedisHookInterface interface {
+	// NewRedisHook 获取日志上报 hook 对象
+	NewRedisHook(conf RedisHookConf) (*RedisHook, error)
+
+	// Levels 上报的日志级别
+	Levels() []logrus.Level
+	// Fire 日志放入内存队列，由后台协程批量发送
+	Fire(entry *logrus.Entry) error
+	// Close 发送剩余日志并停止后台协程
+	Close() error
+	// Dropped 获取被丢弃的日志条数
+	Dropped() uint64
+}
+
+// NewRedisHook 获取日志上报 hook 对象
+func NewRedisHook(conf RedisHookConf) (*RedisHook, error) {
+	if conf.Host == "" || conf.Port == "" {
+		return nil, errors.New("params err")
+	}
+	if conf.Stream == "" {
+		conf.Stream = defaultHookStream
+	}
+	if conf.MaxLen <= 0 {
+		conf.MaxLen = defaultHookMaxLen
+	}
+	if conf.Level == "" {
+		conf.Level = logrus.WarnLevel.String()
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = defaultHookBatchSize
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = defaultFlushInterval
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = defaultHookQueueSize
+	}
+	if conf.MaxSpoolSize <= 0 {
+		conf.MaxSpoolSize = defaultMaxSpoolSize
+	}
+
+	level, err := logrus.ParseLevel(conf.Level)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+
+	h := &RedisHook{
+		conf:     conf,
+		hostname: hostname,
+		queue:    make(chan map[string]string, conf.QueueSize),
+		done:     make(chan struct{}),
+	}
+	for _, l := range logrus.AllLevels {
+		if l <= level {
+			h.levels = append(h.levels, l)
+		}
+	}
+
+	h.wg.Add(1)
+	go h.run()
+
+	return h, nil
+}
+
+// Levels 上报的日志级别
+func (h *RedisHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire 日志放入内存队列，由后台协程批量发送，队列满时丢弃
+func (h *RedisHook) Fire(entry *logrus.Entry) error {
+	// 自行脱敏，不依赖输出 hook 先于本 hook 执行；已脱敏的内容重复脱敏不会变化
+	redactor := sharedRedactor()
+	rec := map[string]string{
+		"time":  entry.Time.Format(timestampFormat),
+		"level": entry.Level.String(),
+		"msg":   redactor.String(entry.Message),
+		"host":  h.hostname,
+	}
+	if entry.Caller != nil {
+		rec["caller"] = fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+		rec["func"] = entry.Caller.Function
+	}
+	if len(entry.Data) > 0 {
+		data := make(map[string]interface{}, len(entry.Data))
+		for k, v := range redactor.Fields(entry.Data) {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			data[k] = v
+		}
+		if b, err := json.Marshal(data); err == nil {
+			rec["data"] = string(b)
+		}
+	}
+
+	select {
+	case h.queue <- rec:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+
+	return nil
+}
+
+// Close 发送剩余日志并停止后台协程，重复调用安全
+func (h *RedisHook) Close() error {
+	h.once.Do(func() {
+		close(h.done)
+		h.wg.Wait()
+	})
+
+	return nil
+}
+
+// Dropped 获取被丢弃的日志条数（内存队列满或本地落盘失败）
+func (h *RedisHook) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// run 后台发送协程，攒够一批或定时发送
+func (h *RedisHook) run() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(h.conf.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]map[string]string, 0, h.conf.BatchSize)
+	for {
+		select {
+		case rec := <-h.queue:
+			batch = append(batch, rec)
+			if len(batch) >= h.conf.BatchSize {
+				h.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			h.flush(batch)
+			batch = batch[:0]
+		case <-h.done:
+			for {
+				select {
+				case rec := <-h.queue:
+					batch = append(batch, rec)
+				default:
+					h.flush(batch)
+					if h.conn != nil {
+						h.reset()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 发送一批日志；先重放本地落盘的日志保证顺序，redis 不可用时落盘
+func (h *RedisHook) flush(batch []map[string]string) {
+	if len(batch) == 0 && !h.hasSpool() {
+		return
+	}
+
+	// 1、获取 redis 连接
+	if h.conn == nil {
+		timeout := hookRedisTimeout * time.Millisecond
+		conn, err := redis.Dial("tcp", h.conf.Host+":"+h.conf.Port, redis.DialPassword(h.conf.Passwd),
+			redis.DialConnectTimeout(timeout), redis.DialReadTimeout(timeout), redis.DialWriteTimeout(timeout))
+		if err != nil {
+			h.spool(batch)
+			return
+		}
+		h.conn = conn
+	}
+
+	// 2、重放本地落盘的日志
+	if err := h.replay(); err != nil {
+		h.reset()
+		h.spool(batch)
+		return
+	}
+
+	// 3、发送本批日志，失败时剩余部分落盘
+	if n, err := h.send(batch); err != nil {
+		h.reset()
+		h.spool(batch[n:])
+	}
+}
+
+// send 通过 pipeline 一次发送多条日志，返回成功写入的条数
+func (h *RedisHook) send(batch []map[string]string) (int, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	// 1、全部 XADD 命令写入缓冲区后一次发送
+	for _, rec := range batch {
+		args := redis.Args{}.Add(h.conf.Stream, "MAXLEN", "~", h.conf.MaxLen, "*")
+		for k, v := range rec {
+			args = args.Add(k, v)
+		}
+		if err := h.conn.Send("XADD", args...); err != nil {
+			return 0, err
+		}
+	}
+	if err := h.conn.Flush(); err != nil {
+		return 0, err
+	}
+
+	// 2、按顺序读取每条命令的结果
+	for i := range batch {
+		if _, err := h.conn.Receive(); err != nil {
+			return i, err
+		}
+	}
+
+	return len(batch), nil
+}
+
+// reset 关闭 redis 连接，下次发送前重连
+func (h *RedisHook) reset() {
+	h.conn.Close()
+	h.conn = nil
+}
+
+// hasSpool 判断是否有待重放的落盘日志
+func (h *RedisHook) hasSpool() bool {
+	if h.conf.SpoolPath == "" {
+		return false
+	}
+	_, err := os.Stat(h.conf.SpoolPath)
+
+	return err == nil
+}
+
+// spool 日志落盘，文件超过大小上限时丢弃
+func (h *RedisHook) spool(batch []map[string]string) {
+	if len(batch) == 0 {
+		return
+	}
+	if h.conf.SpoolPath == "" {
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+	if info, err := os.Stat(h.conf.SpoolPath); err == nil && info.Size() >= h.conf.MaxSpoolSize {
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+
+	file, err := os.OpenFile(h.conf.SpoolPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, rec := range batch {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			atomic.AddUint64(&h.dropped, 1)
+			continue
+		}
+		writer.Write(append(b, '\n'))
+	}
+	writer.Flush()
+}
+
+// replay 重放本地落盘的日志，全部成功后删除落盘文件；失败时未发送的部分写回落盘文件
+func (h *RedisHook) replay() error {
+	if h.conf.SpoolPath == "" {
+		return nil
+	}
+	file, err := os.Open(h.conf.SpoolPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// 1、按批次 pipeline 发送
+	var sendErr error
+	var pending []string
+	lines := make([]string, 0, h.conf.BatchSize)
+	batch := make([]map[string]string, 0, h.conf.BatchSize)
+	sendBatch := func() {
+		if n, err := h.send(batch); err != nil {
+			sendErr = err
+			pending = append(pending, lines[n:]...)
+		}
+		lines, batch = lines[:0], batch[:0]
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if sendErr != nil {
+			pending = append(pending, line)
+			continue
+		}
+
+		rec := make(map[string]string)
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || len(rec) == 0 {
+			continue
+		}
+		lines, batch = append(lines, line), append(batch, rec)
+		if len(batch) >= h.conf.BatchSize {
+			sendBatch()
+		}
+	}
+	if sendErr == nil {
+		sendBatch()
+	}
+	file.Close()
+
+	// 2、全部发送成功则删除落盘文件，否则将剩余部分写回
+	if sendErr == nil {
+		return os.Remove(h.conf.SpoolPath)
+	}
+	tmpPath := h.conf.SpoolPath + ".tmp"
+	content := strings.Join(pending, "\n") + "\n"
+	if err := ioutil.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return sendErr
+	}
+	os.Rename(tmpPath, h.conf.SpoolPath)
+
+	return sendErr
+}
@@ -0,0 +1,224 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxSampleKeys 采样和去重最多跟踪的日志种类数，超出后新种类的日志直接放行，避免内存无限增长
+const maxSampleKeys = 10000
+
+// templateReg 提取日志模板时需要抹掉的变量部分（数字，如 ip、端口、id、耗时等）
+var templateReg = regexp.MustCompile(`[0-9]+`)
+
+// SamplingConf 日志采样和重复抑制配置结构，panic/fatal 级别日志以及 Recover 记录的 panic 日志不受影响
+type SamplingConf struct {
+	// Interval 采样周期，单位：ms，为 0 表示不开启采样
+	Interval int
+	// First 每个采样周期内，同一级别同一模板的日志前 First 条全部输出
+	First int
+	// Thereafter 超过 First 条后每 Thereafter 条输出 1 条，为 0 表示全部丢弃
+	Thereafter int
+
+	// DedupWindow 重复日志抑制窗口，单位：ms，为 0 表示不开启；
+	// 窗口内完全相同的日志只输出第一条，窗口结束时输出 "message repeated N times" 汇总
+	DedupWindow int
+}
+
+// sampleKey 采样和去重的 key
+type sampleKey struct {
+	level logrus.Level
+	msg   string
+}
+
+// dupRecord 重复日志记录
+type dupRecord struct {
+	entry      *logrus.Entry
+	first      time.Time
+	suppressed int
+}
+
+// sampler 日志采样和重复抑制对象
+type sampler struct {
+	conf SamplingConf
+	emit func(entries []*logrus.Entry)
+
+	mu          sync.Mutex
+	periodStart time.Time
+	counters    map[sampleKey]int
+	dups        map[sampleKey]*dupRecord
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newSampler 获取采样对象，未开启采样和去重时返回 nil
+func newSampler(conf SamplingConf, emit func(entries []*logrus.Entry)) *sampler {
+	if conf.Interval <= 0 && conf.DedupWindow <= 0 {
+		return nil
+	}
+
+	s := &sampler{
+		conf:        conf,
+		emit:        emit,
+		periodStart: time.Now(),
+		counters:    make(map[sampleKey]int),
+		dups:        make(map[sampleKey]*dupRecord),
+		done:        make(chan struct{}),
+	}
+	if conf.DedupWindow > 0 {
+		s.wg.Add(1)
+		go s.run()
+	}
+
+	return s
+}
+
+// messageTemplate 获取日志模板，抹掉日志中的数字部分
+func messageTemplate(msg string) string {
+	return templateReg.ReplaceAllString(msg, "#")
+}
+
+// run 定时输出到期的重复日志汇总
+func (s *sampler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(s.conf.DedupWindow) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if summaries := s.expire(time.Now(), false); len(summaries) > 0 {
+				s.emit(summaries)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// stop 停止后台协程，并输出尚未输出的重复日志汇总
+func (s *sampler) stop() {
+	close(s.done)
+	s.wg.Wait()
+
+	if summaries := s.expire(time.Now(), true); len(summaries) > 0 {
+		s.emit(summaries)
+	}
+}
+
+// noSampleKey 日志 context 中带有该 key 时不参与采样和去重，如 panic 日志，见 withoutSampling
+type noSampleKey struct{}
+
+// withoutSampling 返回不参与采样和去重的日志对象
+func withoutSampling() *logrus.Entry {
+	return logrus.WithContext(context.WithValue(context.Background(), noSampleKey{}, true))
+}
+
+// allow 判断日志是否放行，同时返回需要先行输出的重复日志汇总
+func (s *sampler) allow(entry *logrus.Entry) (bool, []*logrus.Entry) {
+	if entry.Level <= logrus.FatalLevel {
+		return true, nil
+	}
+	if entry.Context != nil && entry.Context.Value(noSampleKey{}) != nil {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var summaries []*logrus.Entry
+
+	// 1、重复抑制，窗口内完全相同的日志只计数
+	dupKey := sampleKey{level: entry.Level, msg: entry.Message}
+	if s.conf.DedupWindow > 0 {
+		if rec, ok := s.dups[dupKey]; ok {
+			if now.Sub(rec.first) < time.Duration(s.conf.DedupWindow)*time.Millisecond {
+				rec.suppressed++
+				return false, nil
+			}
+			if rec.suppressed > 0 {
+				summaries = append(summaries, repeatedEntry(rec))
+			}
+			delete(s.dups, dupKey)
+		}
+	}
+
+	// 2、按模板采样，每个周期内前 First 条放行，之后每 Thereafter 条放行 1 条
+	if s.conf.Interval > 0 {
+		if now.Sub(s.periodStart) >= time.Duration(s.conf.Interval)*time.Millisecond {
+			s.counters = make(map[sampleKey]int)
+			s.periodStart = now
+		}
+		key := sampleKey{level: entry.Level, msg: messageTemplate(entry.Message)}
+		n, ok := s.counters[key]
+		if ok || len(s.counters) < maxSampleKeys {
+			n++
+			s.counters[key] = n
+			if n > s.conf.First && (s.conf.Thereafter <= 0 || (n-s.conf.First)%s.conf.Thereafter != 0) {
+				return false, summaries
+			}
+		}
+	}
+
+	// 3、放行的日志记录下来，用于后续的重复抑制
+	if s.conf.DedupWindow > 0 && len(s.dups) < maxSampleKeys {
+		s.dups[dupKey] = &dupRecord{entry: copyEntry(entry), first: now}
+	}
+
+	return true, summaries
+}
+
+// expire 清理到期的重复日志记录，返回需要输出的汇总；all 为 true 时清理全部记录
+func (s *sampler) expire(now time.Time, all bool) []*logrus.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summaries []*logrus.Entry
+	window := time.Duration(s.conf.DedupWindow) * time.Millisecond
+	for key, rec := range s.dups {
+		if !all && now.Sub(rec.first) < window {
+			continue
+		}
+		if rec.suppressed > 0 {
+			summaries = append(summaries, repeatedEntry(rec))
+		}
+		delete(s.dups, key)
+	}
+
+	return summaries
+}
+
+// repeatedEntry 生成重复日志汇总
+func repeatedEntry(rec *dupRecord) *logrus.Entry {
+	entry := copyEntry(rec.entry)
+	entry.Time = time.Now()
+	entry.Message = fmt.Sprintf("message repeated %d times: %s", rec.suppressed, rec.entry.Message)
+
+	return entry
+}
+
+// copyEntry 拷贝日志对象，logrus 的 Entry 会被复用，需要保留时必须拷贝
+func copyEntry(entry *logrus.Entry) *logrus.Entry {
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+
+	return &logrus.Entry{
+		Logger:  entry.Logger,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   entry.Level,
+		Caller:  entry.Caller,
+		Message: entry.Message,
+		Context: entry.Context,
+	}
+}
@@ -0,0 +1,317 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/sirupsen/logrus"
+)
+
+// 输出类型定义
+const (
+	// SinkFile 按时间切割的日志文件
+	SinkFile = "file"
+	// SinkStdout 标准输出
+	SinkStdout = "stdout"
+	// SinkStderr 标准错误输出
+	SinkStderr = "stderr"
+	// SinkSyslog 本机 syslog（unix socket）
+	SinkSyslog = "syslog"
+)
+
+// 格式化类型定义
+const (
+	// FormatText 文本格式
+	FormatText = "text"
+	// FormatJSON json 格式
+	FormatJSON = "json"
+)
+
+// timestampFormat 日志时间格式
+const timestampFormat = "2006-01-02 15:04:05"
+
+// SinkConf 单个日志输出配置结构
+type SinkConf struct {
+	// Type 输出类型：file/stdout/stderr/syslog
+	Type string
+	// Level 最低日志级别，如 warn 表示只接收 warn 及以上级别；为空默认 info
+	Level string
+	// Formatter 格式化类型：text/json，为空默认 text
+	Formatter string
+
+	// LogPath 日志文件路径，Type 为 file 时生效
+	LogPath string
+	// RotationTime 日志切割时间间隔，单位：小时，Type 为 file 时生效
+	RotationTime int
+	// RotationCount 日志保留个数，Type 为 file 时生效
+	RotationCount int
+
+	// SyslogTag syslog 标识，Type 为 syslog 时生效，为空默认取进程名
+	SyslogTag string
+
+	// Async 是否开启异步写，syslog 不支持
+	Async bool
+	// AsyncConf 异步写配置，Async 为 true 时生效
+	AsyncConf AsyncConf
+}
+
+// levelWriter 需要感知日志级别的输出，如 syslog 需按级别设置优先级
+type levelWriter interface {
+	WriteLevel(level logrus.Level, p []byte) (int, error)
+}
+
+// sink 单个日志输出对象
+type sink struct {
+	writer    io.Writer
+	closer    io.Closer
+	async     *AsyncWriter
+	formatter logrus.Formatter
+	level     logrus.Level
+}
+
+// sinkHook 将日志分发到多个输出的 logrus hook，每个输出有独立的格式和级别
+type sinkHook struct {
+	mu       sync.RWMutex
+	sinks    []*sink
+	sampler  *sampler
+	redactor *Redactor
+}
+
+// discardFormatter 配合 sinkHook 使用，logrus 自身的输出不再需要格式化
+type discardFormatter struct{}
+
+// Format 返回空内容
+func (f *discardFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// newFormatter 根据配置获取格式化对象
+func newFormatter(name string) (logrus.Formatter, error) {
+	switch name {
+	case "", FormatText:
+		return &logrus.TextFormatter{TimestampFormat: timestampFormat}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{TimestampFormat: timestampFormat}, nil
+	}
+
+	return nil, errors.New("invalid formatter:" + name)
+}
+
+// newRotateWriter 获取按时间切割的文件输出
+func newRotateWriter(path string, rotateHour int, rotateCount int) (*rotatelogs.RotateLogs, error) {
+	if rotateHour <= 0 {
+		rotateHour = rotationTime
+	}
+	if rotateCount <= 0 {
+		rotateCount = rotationCount
+	}
+
+	return rotatelogs.New(
+		path+".%Y%m%d%H",
+		rotatelogs.WithLinkName(path),
+		rotatelogs.WithRotationCount(uint(rotateCount)),
+		rotatelogs.WithRotationTime(time.Duration(rotateHour)*time.Hour),
+	)
+}
+
+// newSink 根据配置获取单个日志输出对象
+func newSink(c SinkConf) (*sink, error) {
+	// 1、解析级别和格式
+	level := logrus.InfoLevel
+	if c.Level != "" {
+		l, err := logrus.ParseLevel(c.Level)
+		if err != nil {
+			return nil, err
+		}
+		level = l
+	}
+	formatter, err := newFormatter(c.Formatter)
+	if err != nil {
+		return nil, err
+	}
+	s := &sink{formatter: formatter, level: level}
+
+	// 2、根据类型获取输出
+	switch c.Type {
+	case "", SinkFile:
+		if c.LogPath == "" {
+			return nil, errors.New("file sink log path is empty")
+		}
+		writer, err := newRotateWriter(c.LogPath, c.RotationTime, c.RotationCount)
+		if err != nil {
+			return nil, err
+		}
+		s.writer, s.closer = writer, writer
+	case SinkStdout:
+		s.writer = os.Stdout
+	case SinkStderr:
+		s.writer = os.Stderr
+	case SinkSyslog:
+		writer, err := newSyslogWriter(c.SyslogTag)
+		if err != nil {
+			return nil, err
+		}
+		s.writer, s.closer = writer, writer
+		return s, nil
+	default:
+		return nil, errors.New("invalid sink type:" + c.Type)
+	}
+
+	// 3、按需包一层异步写
+	if c.Async {
+		s.async = NewAsyncWriter(s.writer, c.AsyncConf)
+		s.writer = s.async
+	}
+
+	return s, nil
+}
+
+// fire 格式化并写入单个输出
+func (s *sink) fire(entry *logrus.Entry) error {
+	if entry.Level > s.level {
+		return nil
+	}
+
+	b, err := s.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	if lw, ok := s.writer.(levelWriter); ok {
+		_, err = lw.WriteLevel(entry.Level, b)
+		return err
+	}
+	_, err = s.writer.Write(b)
+
+	return err
+}
+
+// flush 将异步写缓冲区落盘
+func (s *sink) flush() error {
+	if s.async == nil {
+		return nil
+	}
+
+	return s.async.Flush()
+}
+
+// close 关闭输出，标准输出不关闭
+func (s *sink) close() error {
+	if s.async != nil {
+		s.async.Close()
+	}
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
+
+// Levels 接收全部级别，由各输出自行过滤
+func (h *sinkHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 分发日志到各输出，开启采样时先判断是否放行；
+// 脱敏在采样之前执行，被采样丢弃的日志同样会被脱敏，之后注册的 hook 拿到的都是脱敏后的日志
+func (h *sinkHook) Fire(entry *logrus.Entry) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.redactor.entry(entry)
+	if h.sampler == nil {
+		return h.write([]*logrus.Entry{entry})
+	}
+
+	pass, entries := h.sampler.allow(entry)
+	if pass {
+		entries = append(entries, entry)
+	}
+
+	return h.write(entries)
+}
+
+// emit 绕过采样直接输出，用于输出重复日志汇总
+func (h *sinkHook) emit(entries []*logrus.Entry) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.write(entries)
+}
+
+// write 写入各输出，日志已在 Fire 中脱敏，调用方需持有读锁；单个输出失败不影响其他输出
+func (h *sinkHook) write(entries []*logrus.Entry) error {
+	var firstErr error
+	for _, entry := range entries {
+		for _, s := range h.sinks {
+			if err := s.fire(entry); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// setSampler 替换采样对象，旧的采样对象停止并输出剩余的汇总
+func (h *sinkHook) setSampler(s *sampler) {
+	h.mu.Lock()
+	old := h.sampler
+	h.sampler = s
+	h.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
+
+// setRedactor 替换脱敏对象
+func (h *sinkHook) setRedactor(r *Redactor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.redactor = r
+}
+
+// setSinks 替换输出列表，返回旧的输出列表
+func (h *sinkHook) setSinks(sinks []*sink) []*sink {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old := h.sinks
+	h.sinks = sinks
+
+	return old
+}
+
+// flush 将全部输出的异步写缓冲区落盘
+func (h *sinkHook) flush() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var firstErr error
+	for _, s := range h.sinks {
+		if err := s.flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// close 关闭全部输出
+func (h *sinkHook) close() error {
+	h.setSampler(nil)
+
+	var firstErr error
+	for _, s := range h.setSinks(nil) {
+		if err := s.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"log/syslog"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogWriter 本机 syslog 输出，按日志级别设置 syslog 优先级
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+// newSyslogWriter 通过 unix socket 连接本机 syslog
+func newSyslogWriter(tag string) (*syslogWriter, error) {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogWriter{writer}, nil
+}
+
+// WriteLevel 按日志级别写入 syslog
+func (w *syslogWriter) WriteLevel(level logrus.Level, p []byte) (int, error) {
+	msg := string(p)
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return len(p), w.Crit(msg)
+	case logrus.ErrorLevel:
+		return len(p), w.Err(msg)
+	case logrus.WarnLevel:
+		return len(p), w.Warning(msg)
+	case logrus.InfoLevel:
+		return len(p), w.Info(msg)
+	}
+
+	return len(p), w.Debug(msg)
+}
@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+// newSyslogWriter 当前系统不支持 syslog
+func newSyslogWriter(tag string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this system")
+}
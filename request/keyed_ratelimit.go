@@ -0,0 +1,193 @@
+package request
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// KeyedLimiterInterface 接口整理
+type KeyedLimiterInterface interface {
+	// NewKeyedLimiter 初始化按 key 限流对象，每个 key 第一次请求时按规则创建独立的令牌桶
+	NewKeyedLimiter(conf KeyedLimiterConf) (*KeyedRateLimit, error)
+	// IsPass 指定 key 的请求是否放行，参数表示获取令牌等待超时时间，单位：ms
+	IsPass(key string, timeOut time.Duration) bool
+	// SetOverride 设置指定 key 的 QPS，覆盖默认规则
+	SetOverride(key string, bucketSize int) error
+	// DelOverride 删除指定 key 的 QPS 覆盖，恢复默认规则
+	DelOverride(key string)
+	// Len 当前保留的 key 个数
+	Len() int
+}
+
+// 按 key 限流默认配置
+const (
+	// defaultIdleTimeout key 空闲回收时间默认值，单位：秒
+	defaultIdleTimeout = 600
+	// defaultMaxKeys 最多保留的 key 个数默认值
+	defaultMaxKeys = 10000
+)
+
+// KeyedLimiterConf 按 key 限流配置结构
+type KeyedLimiterConf struct {
+	// BucketSize 默认规则，每个 key 每秒放行的请求个数
+	BucketSize int
+	// Overrides 指定 key 的每秒放行请求个数，覆盖默认规则，如付费租户使用更高的 QPS
+	Overrides map[string]int
+	// IdleTimeout 超过该时间没有请求的 key 被回收，单位：秒，为 0 默认 600
+	IdleTimeout int
+	// MaxKeys 最多保留的 key 个数，超过时回收最久没有请求的 key，为 0 默认 10000
+	MaxKeys int
+}
+
+// keyedEntry 单个 key 的令牌桶
+type keyedEntry struct {
+	key      string
+	limiter  *RateLimit
+	lastUsed time.Time
+}
+
+// KeyedRateLimit 按 key 限流对象结构体，如按用户、API key、IP 分别限流；
+// key 按最近请求时间组成 LRU 链表，请求时顺带回收空闲超时和超出数量上限的 key，不需要后台协程。
+// 被回收的 key 再次请求时重新创建令牌桶（桶是满的），因此 IdleTimeout 不应小于 1 秒
+type KeyedRateLimit struct {
+	bucketSize  int
+	idleTimeout time.Duration
+	maxKeys     int
+
+	mu        sync.Mutex
+	overrides map[string]int
+	entries   map[string]*list.Element
+	// lru 链表头部为最近请求的 key
+	lru *list.List
+}
+
+// NewKeyedLimiter 初始化按 key 限流对象，每个 key 第一次请求时按规则创建独立的令牌桶
+func NewKeyedLimiter(conf KeyedLimiterConf) (*KeyedRateLimit, error) {
+	if conf.BucketSize <= 0 {
+		return nil, errors.New("param error")
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = defaultIdleTimeout
+	}
+	if conf.MaxKeys <= 0 {
+		conf.MaxKeys = defaultMaxKeys
+	}
+
+	overrides := make(map[string]int, len(conf.Overrides))
+	for key, bucketSize := range conf.Overrides {
+		if bucketSize <= 0 {
+			return nil, errors.New("param error, key:" + key)
+		}
+		overrides[key] = bucketSize
+	}
+
+	return &KeyedRateLimit{
+		bucketSize:  conf.BucketSize,
+		idleTimeout: time.Duration(conf.IdleTimeout) * time.Second,
+		maxKeys:     conf.MaxKeys,
+		overrides:   overrides,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}, nil
+}
+
+// IsPass 指定 key 的请求是否放行，参数表示获取令牌等待超时时间，单位：ms
+func (keyed *KeyedRateLimit) IsPass(key string, timeOut time.Duration) bool {
+	limiter, err := keyed.get(key)
+	if err != nil {
+		return false
+	}
+
+	// 等待令牌时不持有锁，避免阻塞其他 key
+	return limiter.IsPass(timeOut)
+}
+
+// SetOverride 设置指定 key 的 QPS，覆盖默认规则，已存在的令牌桶立即按新规则重建
+func (keyed *KeyedRateLimit) SetOverride(key string, bucketSize int) error {
+	if key == "" || bucketSize <= 0 {
+		return errors.New("param error")
+	}
+
+	keyed.mu.Lock()
+	defer keyed.mu.Unlock()
+
+	keyed.overrides[key] = bucketSize
+	keyed.remove(key)
+
+	return nil
+}
+
+// DelOverride 删除指定 key 的 QPS 覆盖，已存在的令牌桶立即按默认规则重建
+func (keyed *KeyedRateLimit) DelOverride(key string) {
+	keyed.mu.Lock()
+	defer keyed.mu.Unlock()
+
+	if _, ok := keyed.overrides[key]; !ok {
+		return
+	}
+	delete(keyed.overrides, key)
+	keyed.remove(key)
+}
+
+// Len 当前保留的 key 个数
+func (keyed *KeyedRateLimit) Len() int {
+	keyed.mu.Lock()
+	defer keyed.mu.Unlock()
+
+	return keyed.lru.Len()
+}
+
+// get 获取 key 的令牌桶，不存在时按规则创建，同时回收空闲和超出数量上限的 key
+func (keyed *KeyedRateLimit) get(key string) (*RateLimit, error) {
+	if key == "" {
+		return nil, errors.New("param error")
+	}
+	now := time.Now()
+
+	keyed.mu.Lock()
+	defer keyed.mu.Unlock()
+
+	// 1、已存在的 key 移到链表头部
+	if elem, ok := keyed.entries[key]; ok {
+		entry := elem.Value.(*keyedEntry)
+		entry.lastUsed = now
+		keyed.lru.MoveToFront(elem)
+		keyed.evict(now)
+		return entry.limiter, nil
+	}
+
+	// 2、按覆盖规则或默认规则创建令牌桶
+	bucketSize, ok := keyed.overrides[key]
+	if !ok {
+		bucketSize = keyed.bucketSize
+	}
+	limiter, err := NewLimiter(bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	keyed.entries[key] = keyed.lru.PushFront(&keyedEntry{key: key, limiter: limiter, lastUsed: now})
+	keyed.evict(now)
+
+	return limiter, nil
+}
+
+// evict 从链表尾部回收空闲超时的 key 和超出数量上限的 key，调用方需持有 mu
+func (keyed *KeyedRateLimit) evict(now time.Time) {
+	for elem := keyed.lru.Back(); elem != nil; elem = keyed.lru.Back() {
+		entry := elem.Value.(*keyedEntry)
+		if keyed.lru.Len() <= keyed.maxKeys && now.Sub(entry.lastUsed) < keyed.idleTimeout {
+			return
+		}
+		keyed.remove(entry.key)
+	}
+}
+
+// remove 删除 key 的令牌桶，调用方需持有 mu
+func (keyed *KeyedRateLimit) remove(key string) {
+	if elem, ok := keyed.entries[key]; ok {
+		keyed.lru.Remove(elem)
+		delete(keyed.entries, key)
+	}
+}
@@ -0,0 +1,196 @@
+package request
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+	"github.com/xiyouhpy/tool/store"
+)
+
+// RedisLimiterInterface 接口整理
+type RedisLimiterInterface interface {
+	// NewRedisLimiter 初始化分布式限流对象，限流状态保存在 redis 中，多个实例共享同一个 QPS 配额
+	NewRedisLimiter(conf RedisLimiterConf) (*RedisRateLimit, error)
+	// IsPass 分布式限流请求是否放行，参数表示获取令牌等待超时时间，单位：ms
+	IsPass(timeOut time.Duration) bool
+	// Close 关闭限流对象自己创建的连接池
+	Close() error
+}
+
+// rateLimitPrefix 分布式限流 key 前缀
+const rateLimitPrefix = "rate_limit_"
+
+// redisRetryInterval redis 异常后在该时间内直接使用降级策略，不再请求 redis，单位：毫秒
+const redisRetryInterval = 1000
+
+// gcraScript GCRA（通用信元速率算法）限流，使用 redis 服务端时间避免各实例时钟不一致；
+// key 中保存理论到达时间 tat，单位：微秒
+// ARGV：令牌产生间隔、突发容忍时间（间隔 * 桶容量）、最长等待时间，单位：微秒
+// 返回值：>= 0 放行，值为需要等待的微秒数；-1 拒绝
+var gcraScript = redis.NewScript(1, `
+redis.replicate_commands()
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local maxWait = tonumber(ARGV[3])
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local newTat = tat + interval
+local wait = newTat - tolerance - now
+if wait < 0 then
+	wait = 0
+end
+if wait > maxWait then
+	return -1
+end
+redis.call("SET", KEYS[1], string.format("%d", newTat), "PX", math.ceil((newTat - now) / 1000) + 1)
+return wait
+`)
+
+// RedisLimiterConf 分布式限流配置结构
+type RedisLimiterConf struct {
+	// Host/Port/Passwd redis 地址和密码
+	Host   string
+	Port   string
+	Passwd string
+	// Pool 共享的 redis 连接池，不为空时忽略 Host/Port/Passwd
+	Pool *redis.Pool
+
+	// Key 限流名称，同名的限流对象共享同一个 QPS 配额
+	Key string
+	// QPS 全部实例合计每秒放行的请求个数
+	QPS int
+	// Burst 令牌桶最大容量，即允许的瞬时突发请求个数，为 0 默认与 QPS 相同
+	Burst int
+
+	// LocalQPS redis 不可用时降级为本地限流的单实例 QPS，一般配置为 QPS / 实例数；为 0 时按 FailOpen 处理
+	LocalQPS int
+	// FailOpen redis 不可用且没有配置 LocalQPS 时，为 true 全部放行，为 false 全部拒绝
+	FailOpen bool
+}
+
+// RedisRateLimit 分布式限流对象结构体，与 RateLimit 使用方式相同
+type RedisRateLimit struct {
+	conf    RedisLimiterConf
+	pool    *redis.Pool
+	ownPool bool
+	key     string
+	// interval/tolerance 令牌产生间隔、突发容忍时间，单位：微秒
+	interval  int64
+	tolerance int64
+	// local redis 不可用时的本地限流，没有配置 LocalQPS 时为 nil
+	local *RateLimit
+
+	// mu 保护 downUntil
+	mu sync.Mutex
+	// downUntil redis 异常后在该时间之前直接使用降级策略
+	downUntil time.Time
+}
+
+// NewRedisLimiter 初始化分布式限流对象，限流状态保存在 redis 中，多个实例共享同一个 QPS 配额
+func NewRedisLimiter(conf RedisLimiterConf) (*RedisRateLimit, error) {
+	if conf.Key == "" || conf.QPS <= 0 || (conf.Pool == nil && (conf.Host == "" || conf.Port == "")) {
+		return nil, errors.New("param error")
+	}
+	if conf.Burst <= 0 {
+		conf.Burst = conf.QPS
+	}
+
+	interval := int64(time.Second/time.Microsecond) / int64(conf.QPS)
+	if interval < 1 {
+		interval = 1
+	}
+	limit := &RedisRateLimit{
+		conf:      conf,
+		pool:      conf.Pool,
+		key:       rateLimitPrefix + conf.Key,
+		interval:  interval,
+		tolerance: interval * int64(conf.Burst),
+	}
+
+	if conf.LocalQPS > 0 {
+		local, err := NewLimiter(conf.LocalQPS)
+		if err != nil {
+			return nil, err
+		}
+		limit.local = local
+	}
+	if limit.pool == nil {
+		pool, err := store.NewRedisPool(store.RedisPoolConf{Host: conf.Host, Port: conf.Port, Passwd: conf.Passwd})
+		if err != nil {
+			return nil, err
+		}
+		limit.pool, limit.ownPool = pool, true
+	}
+
+	return limit, nil
+}
+
+// IsPass 分布式限流请求是否放行，参数表示获取令牌等待超时时间，单位：ms；
+// redis 不可用时按 LocalQPS/FailOpen 降级
+func (limit *RedisRateLimit) IsPass(timeOut time.Duration) bool {
+	// 1、redis 异常后的一段时间内直接降级，避免每个请求都等待 redis 超时
+	if limit.isDown() {
+		return limit.fallback(timeOut)
+	}
+
+	// 2、从 redis 获取令牌，等待时间在超时时间内时预占令牌并等待
+	maxWait := (timeOut * time.Millisecond).Microseconds()
+	conn := limit.pool.Get()
+	wait, err := redis.Int64(gcraScript.Do(conn, limit.key, limit.interval, limit.tolerance, maxWait))
+	conn.Close()
+	if err != nil {
+		logrus.Warnf("rate limit script err, key:%s, err:%s", limit.key, err.Error())
+		limit.setDown()
+		return limit.fallback(timeOut)
+	}
+	if wait < 0 {
+		return false
+	}
+	if wait > 0 {
+		time.Sleep(time.Duration(wait) * time.Microsecond)
+	}
+
+	return true
+}
+
+// Close 关闭限流对象自己创建的连接池
+func (limit *RedisRateLimit) Close() error {
+	if limit.ownPool {
+		return limit.pool.Close()
+	}
+
+	return nil
+}
+
+// fallback redis 不可用时的降级策略
+func (limit *RedisRateLimit) fallback(timeOut time.Duration) bool {
+	if limit.local != nil {
+		return limit.local.IsPass(timeOut)
+	}
+
+	return limit.conf.FailOpen
+}
+
+// isDown 是否处于 redis 异常降级期间
+func (limit *RedisRateLimit) isDown() bool {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+
+	return time.Now().Before(limit.downUntil)
+}
+
+// setDown 标记 redis 异常，之后 redisRetryInterval 内直接降级
+func (limit *RedisRateLimit) setDown() {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+
+	limit.downUntil = time.Now().Add(redisRetryInterval * time.Millisecond)
+}
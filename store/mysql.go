@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -22,6 +23,11 @@ type MysqlInterface interface {
 	Update(strSql string, args ...interface{}) (int64, error)
 	// Delete mysql delete 操作
 	Delete(strSql string, args ...interface{}) (int64, error)
+
+	// Conn 获取独占的 mysql 连接
+	Conn(ctx context.Context) (*sql.Conn, error)
+	// FencedUpdate 带 fencing token 的 update 操作
+	FencedUpdate(table string, sets string, setArgs []interface{}, where string, whereArgs []interface{}, token int64) (int64, error)
 }
 
 // MysqlCli mysql 对象结构
@@ -38,6 +44,13 @@ type mysqlConfig struct {
 	dbname string
 }
 
+// fenceColumn fencing token 字段名，使用 FencedUpdate 的表需要增加该字段：
+// fence_token BIGINT NOT NULL DEFAULT 0
+const fenceColumn = "fence_token"
+
+// ErrStaleToken 写入携带的 fencing token 比记录中的小，说明锁已被新的持有者获取
+var ErrStaleToken = errors.New("stale fencing token")
+
 // 全局变量定义
 var (
 	// mysqlCli mysql 对象
@@ -224,3 +237,49 @@ func (conn *MysqlCli) Delete(strSql string, args ...interface{}) (int64, error)
 
 	return deleteNum, nil
 }
+
+// Conn 获取独占的 mysql 连接，用于 GET_LOCK 等与会话绑定的操作，使用完需调用 Close 归还连接池
+func (conn *MysqlCli) Conn(ctx context.Context) (*sql.Conn, error) {
+	c, err := conn.client.Conn(ctx)
+	if err != nil {
+		logrus.Warnf("mysql Conn err, err:%s", err.Error())
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// FencedUpdate 带 fencing token 的 update 操作，只有 token 不小于记录中的 fence_token 时才更新，并把 fence_token 更新为 token；
+// sets 为 SET 子句（如 "name = ?, age = ?"），where 为 WHERE 子句，记录存在但 token 过期时返回 ErrStaleToken
+func (conn *MysqlCli) FencedUpdate(table string, sets string, setArgs []interface{}, where string, whereArgs []interface{}, token int64) (int64, error) {
+	if table == "" || sets == "" || where == "" || token <= 0 {
+		logrus.Warnf("FencedUpdate params err")
+		return 0, errors.New("params err")
+	}
+
+	// 1、fence_token 条件更新，sql 参数顺序：setArgs、token、whereArgs、token
+	strSql := fmt.Sprintf("UPDATE %s SET %s, %s = ? WHERE (%s) AND %s <= ?", table, sets, fenceColumn, where, fenceColumn)
+	args := make([]interface{}, 0, len(setArgs)+len(whereArgs)+2)
+	args = append(args, setArgs...)
+	args = append(args, token)
+	args = append(args, whereArgs...)
+	args = append(args, token)
+	updateNum, err := conn.Update(strSql, args...)
+	if err != nil || updateNum > 0 {
+		return updateNum, err
+	}
+
+	// 2、没有更新到记录时，区分记录不存在（或数据未变化）和 token 过期
+	var maxToken sql.NullInt64
+	strSql = fmt.Sprintf("SELECT MAX(%s) FROM %s WHERE %s", fenceColumn, table, where)
+	if err := conn.client.QueryRow(strSql, whereArgs...).Scan(&maxToken); err != nil {
+		logrus.Warnf("FencedUpdate QueryRow err, sql:%s", strSql)
+		return 0, err
+	}
+	if maxToken.Valid && maxToken.Int64 > token {
+		logrus.Warnf("FencedUpdate stale token, table:%s, token:%d, current:%d", table, token, maxToken.Int64)
+		return 0, ErrStaleToken
+	}
+
+	return 0, nil
+}
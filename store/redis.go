@@ -29,6 +29,19 @@ type RedisInterface interface {
 	SetEX(key string, value string, seconds int) bool
 	// SetNX redis setNX 方法 <该方法只有在key不存在的时候才会设置成功>
 	SetNX(key string, value string) bool
+
+	// XAdd redis xadd 方法，maxLen 大于 0 时按近似长度裁剪 stream
+	XAdd(key string, maxLen int, fields map[string]string) (string, error)
+
+	// LPush redis lpush 方法
+	LPush(key string, values ...string) (int64, error)
+	// LTrim redis ltrim 方法
+	LTrim(key string, start int, stop int) error
+	// LRange redis lrange 方法
+	LRange(key string, start int, stop int) ([]string, error)
+
+	// Close 关闭 redis 连接
+	Close() error
 }
 
 // RedisCli redis 对象结构
@@ -226,3 +239,80 @@ func (conn *RedisCli) TTL(key string) (int64, error) {
 
 	return intTime, nil
 }
+
+// XAdd redis xadd 方法，maxLen 大于 0 时按近似长度裁剪 stream
+func (conn *RedisCli) XAdd(key string, maxLen int, fields map[string]string) (string, error) {
+	if key == "" || len(fields) == 0 {
+		logrus.Warnf("params error, key:%s, fields:%d", key, len(fields))
+		return "", errors.New("params error, key:" + key)
+	}
+
+	args := redis.Args{}.Add(key)
+	if maxLen > 0 {
+		args = args.Add("MAXLEN", "~", maxLen)
+	}
+	args = args.Add("*")
+	for field, value := range fields {
+		args = args.Add(field, value)
+	}
+
+	id, err := redis.String(conn.client.Do("XADD", args...))
+	if err != nil {
+		logrus.Warnf("redis.Do XADD err, err:%s", err.Error())
+		return "", err
+	}
+
+	return id, nil
+}
+
+// LPush redis lpush 方法，返回 list 长度
+func (conn *RedisCli) LPush(key string, values ...string) (int64, error) {
+	if key == "" || len(values) == 0 {
+		logrus.Warnf("params error, key:%s, values:%d", key, len(values))
+		return 0, errors.New("params error, key:" + key)
+	}
+
+	length, err := redis.Int64(conn.client.Do("LPUSH", redis.Args{}.Add(key).AddFlat(values)...))
+	if err != nil {
+		logrus.Warnf("redis.Do LPUSH err, err:%s", err.Error())
+		return 0, err
+	}
+
+	return length, nil
+}
+
+// LTrim redis ltrim 方法，只保留 [start, stop] 区间的元素
+func (conn *RedisCli) LTrim(key string, start int, stop int) error {
+	if key == "" {
+		logrus.Warnf("params error, key:%s", key)
+		return errors.New("params error, key:" + key)
+	}
+
+	if _, err := conn.client.Do("LTRIM", key, start, stop); err != nil {
+		logrus.Warnf("redis.Do LTRIM err, err:%s", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// LRange redis lrange 方法，返回 [start, stop] 区间的元素
+func (conn *RedisCli) LRange(key string, start int, stop int) ([]string, error) {
+	if key == "" {
+		logrus.Warnf("params error, key:%s", key)
+		return nil, errors.New("params error, key:" + key)
+	}
+
+	values, err := redis.Strings(conn.client.Do("LRANGE", key, start, stop))
+	if err != nil {
+		logrus.Warnf("redis.Do LRANGE err, err:%s", err.Error())
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Close 关闭 redis 连接
+func (conn *RedisCli) Close() error {
+	return conn.client.Close()
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// RedisPoolInterface 接口整理
+type RedisPoolInterface interface {
+	// NewRedisPool 获取 redis 连接池
+	NewRedisPool(conf RedisPoolConf) (*redis.Pool, error)
+	// NewRedisFromPool 从连接池借出一个连接作为 redis 对象
+	NewRedisFromPool(pool *redis.Pool) (*RedisCli, error)
+}
+
+// 连接池默认配置
+const (
+	// defaultPoolTimeout 连接、读写超时时间默认值，单位：毫秒
+	defaultPoolTimeout = 1000
+	// defaultPoolMaxIdle 最大空闲连接数默认值
+	defaultPoolMaxIdle = 8
+	// defaultPoolIdleTimeout 空闲连接超时时间默认值，单位：秒
+	defaultPoolIdleTimeout = 240
+	// poolTestInterval 空闲超过该时间的连接借出前先 PING 检查，单位：秒
+	poolTestInterval = 60
+)
+
+// RedisPoolConf redis 连接池配置结构
+type RedisPoolConf struct {
+	// Host/Port redis 地址
+	Host string
+	Port string
+	// Username redis 6 ACL 用户名，为空时只使用密码鉴权
+	Username string
+	// Passwd 密码，为空时不鉴权
+	Passwd string
+	// DB 数据库编号
+	DB int
+
+	// TLS 是否使用 TLS 连接
+	TLS bool
+	// TLSConfig TLS 配置，为空时使用默认配置
+	TLSConfig *tls.Config
+	// TLSSkipVerify 是否跳过服务端证书校验
+	TLSSkipVerify bool
+
+	// ConnectTimeout/ReadTimeout/WriteTimeout 连接、读、写超时时间，单位：毫秒，为 0 默认 1000
+	ConnectTimeout int
+	ReadTimeout    int
+	WriteTimeout   int
+
+	// MaxIdle 最大空闲连接数，为 0 默认 8
+	MaxIdle int
+	// MaxActive 最大连接数，为 0 不限制
+	MaxActive int
+	// IdleTimeout 空闲连接超时时间，单位：秒，为 0 默认 240
+	IdleTimeout int
+	// Wait 连接数达到 MaxActive 时是否等待空闲连接，为 false 时直接返回错误
+	Wait bool
+}
+
+// NewRedisPool 获取 redis 连接池，连接池可以并发使用，多个锁、客户端可以共享同一个连接池
+func NewRedisPool(conf RedisPoolConf) (*redis.Pool, error) {
+	if conf.Host == "" || conf.Port == "" {
+		logrus.Warnf("NewRedisPool params err")
+		return nil, errors.New("params err")
+	}
+	if conf.MaxIdle <= 0 {
+		conf.MaxIdle = defaultPoolMaxIdle
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = defaultPoolIdleTimeout
+	}
+
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(poolTimeout(conf.ConnectTimeout)),
+		redis.DialReadTimeout(poolTimeout(conf.ReadTimeout)),
+		redis.DialWriteTimeout(poolTimeout(conf.WriteTimeout)),
+		redis.DialUseTLS(conf.TLS),
+		redis.DialTLSSkipVerify(conf.TLSSkipVerify),
+	}
+	if conf.TLSConfig != nil {
+		options = append(options, redis.DialTLSConfig(conf.TLSConfig))
+	}
+	// ACL 鉴权需要 AUTH username password，并且要在 SELECT 之前执行，只有密码时交给 DialPassword/DialDatabase
+	if conf.Username == "" {
+		options = append(options, redis.DialPassword(conf.Passwd), redis.DialDatabase(conf.DB))
+	}
+
+	addr := conf.Host + ":" + conf.Port
+	pool := &redis.Pool{
+		MaxIdle:     conf.MaxIdle,
+		MaxActive:   conf.MaxActive,
+		IdleTimeout: time.Duration(conf.IdleTimeout) * time.Second,
+		Wait:        conf.Wait,
+		Dial: func() (redis.Conn, error) {
+			conn, err := redis.Dial("tcp", addr, options...)
+			if err != nil {
+				logrus.Warnf("redis.Dial err, addr:%s, err:%s", addr, err.Error())
+				return nil, err
+			}
+			if conf.Username != "" {
+				if _, err := conn.Do("AUTH", conf.Username, conf.Passwd); err != nil {
+					logrus.Warnf("redis.Do auth err, addr:%s, user:%s, err:%s", addr, conf.Username, err.Error())
+					conn.Close()
+					return nil, err
+				}
+				if conf.DB != 0 {
+					if _, err := conn.Do("SELECT", conf.DB); err != nil {
+						logrus.Warnf("redis.Do select err, addr:%s, db:%d, err:%s", addr, conf.DB, err.Error())
+						conn.Close()
+						return nil, err
+					}
+				}
+			}
+			return conn, nil
+		},
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < poolTestInterval*time.Second {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+
+	return pool, nil
+}
+
+// NewRedisFromPool 从连接池借出一个连接作为 redis 对象，使用完需要调用 Close 归还连接，不支持并发使用
+func NewRedisFromPool(pool *redis.Pool) (*RedisCli, error) {
+	if pool == nil {
+		logrus.Warnf("NewRedisFromPool params err")
+		return nil, errors.New("params err")
+	}
+
+	client := pool.Get()
+	if err := client.Err(); err != nil {
+		logrus.Warnf("redis pool get err, err:%s", err.Error())
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisCli{client: client}, nil
+}
+
+// poolTimeout 超时时间转换，为 0 时使用默认值
+func poolTimeout(ms int) time.Duration {
+	if ms <= 0 {
+		ms = defaultPoolTimeout
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}